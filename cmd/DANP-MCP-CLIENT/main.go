@@ -13,6 +13,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/sashabaranov/go-openai"
+	danp "github.com/DANP-LABS/DANP-Engine/core/mcp"
 	"github.com/DANP-LABS/DANP-Engine/pkg/mcpclient"
 )
 
@@ -20,6 +21,7 @@ func main() {
 	// Define command line flags
 	stdioCmd := flag.String("stdio", "", "Command to execute for stdio transport (e.g. 'python server.py')")
 	httpURL := flag.String("http", "", "URL for HTTP transport (e.g. 'http://localhost:18080/')")
+	transport := flag.String("transport", mcpclient.TransportStreamableHTTP, "Transport for the -http URL: streamable_http, sse or websocket")
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: No .env file found - using environment variables only")
@@ -27,6 +29,8 @@ func main() {
 
 	deepseekKey := flag.String("deepseek-key", os.Getenv("DEEPSEEK_KEY"), "DeepSeek API key (required for LLM access)")
 	deepseekModel := flag.String("deepseek-model", "deepseek-chat", "DeepSeek model to use (deepseek-chat or deepseek-reasoner)")
+	token := flag.String("token", os.Getenv("DANP_TOKEN"), "API key or JWT for servers that require authentication")
+	walletPath := flag.String("wallet", "", "sign in with this wallet (Sign-In with Ethereum), decrypted with WALLET_PASSWORD")
 	flag.Parse()
 
 	// Validate DeepSeek key
@@ -46,7 +50,18 @@ func main() {
 	defer cancel()
 
 	// Create client
-	client, err := mcpclient.NewClient(ctx, *stdioCmd, *httpURL)
+	opts := []mcpclient.ClientOption{mcpclient.WithTransport(*transport)}
+	if *token != "" {
+		opts = append(opts, mcpclient.WithBearerToken(*token))
+	}
+	if *walletPath != "" {
+		wallet, err := danp.LoadWallet(*walletPath, os.Getenv("WALLET_PASSWORD"))
+		if err != nil {
+			log.Fatalf("Failed to load wallet: %v", err)
+		}
+		opts = append(opts, mcpclient.WithWalletAuth(wallet))
+	}
+	client, err := mcpclient.NewClient(ctx, *stdioCmd, *httpURL, opts...)
 	if err != nil {
 		log.Fatalf("Failed to create client: %v", err)
 	}
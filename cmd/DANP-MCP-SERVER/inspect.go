@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/DANP-LABS/DANP-Engine/core/mcp"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// runInspect lists the exports and imports of a WASM module given as a
+// file path, file:// URL, IPFS:// URL or bare CID
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "manifest whose ipfs settings are used to fetch CIDs")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [flags] <wasm-file|cid>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one WASM file or CID")
+	}
+	target := fs.Arg(0)
+
+	config, err := fetchConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := mcp.FetchWASM(context.Background(), config, target)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	defer runtime.Close(ctx)
+
+	for i, file := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printModule(ctx, runtime, target, file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printModule compiles one WASM binary and prints its interface
+func printModule(ctx context.Context, runtime wazero.Runtime, source string, wasm []byte) error {
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return fmt.Errorf("failed to compile %s: %w", source, err)
+	}
+	defer compiled.Close(ctx)
+
+	sum := sha256.Sum256(wasm)
+	fmt.Printf("Module:  %s\n", source)
+	if name := compiled.Name(); name != "" {
+		fmt.Printf("Name:    %s\n", name)
+	}
+	fmt.Printf("Size:    %d bytes\n", len(wasm))
+	fmt.Printf("SHA-256: %s\n", hex.EncodeToString(sum[:]))
+
+	exports := compiled.ExportedFunctions()
+	names := make([]string, 0, len(exports))
+	for name := range exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("\nExports (%d):\n", len(names))
+	for _, name := range names {
+		fmt.Printf("  %s%s\n", name, signature(exports[name]))
+	}
+	for name, mem := range compiled.ExportedMemories() {
+		fmt.Printf("  %s (memory%s)\n", name, memoryLimits(mem))
+	}
+
+	imports := compiled.ImportedFunctions()
+	sort.Slice(imports, func(i, j int) bool {
+		mi, ni, _ := imports[i].Import()
+		mj, nj, _ := imports[j].Import()
+		if mi != mj {
+			return mi < mj
+		}
+		return ni < nj
+	})
+	fmt.Printf("\nImports (%d):\n", len(imports))
+	for _, def := range imports {
+		module, name, _ := def.Import()
+		fmt.Printf("  %s.%s%s\n", module, name, signature(def))
+	}
+	for _, mem := range compiled.ImportedMemories() {
+		module, name, _ := mem.Import()
+		fmt.Printf("  %s.%s (memory%s)\n", module, name, memoryLimits(mem))
+	}
+	return nil
+}
+
+// signature formats a function type as (i32, i64) -> i32
+func signature(def api.FunctionDefinition) string {
+	params := make([]string, 0, len(def.ParamTypes()))
+	for _, t := range def.ParamTypes() {
+		params = append(params, api.ValueTypeName(t))
+	}
+	sig := "(" + strings.Join(params, ", ") + ")"
+	if results := def.ResultTypes(); len(results) > 0 {
+		names := make([]string, 0, len(results))
+		for _, t := range results {
+			names = append(names, api.ValueTypeName(t))
+		}
+		sig += " -> " + strings.Join(names, ", ")
+	}
+	return sig
+}
+
+// memoryLimits formats the page limits of a memory
+func memoryLimits(mem api.MemoryDefinition) string {
+	limits := fmt.Sprintf(", min %d pages", mem.Min())
+	if max, ok := mem.Max(); ok {
+		limits += fmt.Sprintf(", max %d pages", max)
+	}
+	return limits
+}
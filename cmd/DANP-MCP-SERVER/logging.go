@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/DANP-LABS/DANP-Engine/core/mcp"
+)
+
+// setupLogging installs the server's structured logger on stderr, which
+// stays free of protocol traffic on every transport. The --log-level and
+// --log-format flags, when given, override the manifest's logging block.
+// The standard logger, still used by the IPFS and client packages, writes
+// through the same handler at info level.
+func setupLogging(cfg mcp.LoggingConfig, levelFlag, formatFlag string) error {
+	if levelFlag != "" {
+		cfg.Level = levelFlag
+	}
+	if formatFlag != "" {
+		cfg.Format = formatFlag
+	}
+	level, err := mcp.ParseLogLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	handler, err := mcp.NewLogHandler(os.Stderr, cfg.Format, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
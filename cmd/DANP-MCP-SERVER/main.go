@@ -1,39 +1,242 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/DANP-LABS/DANP-Engine/core/mcp"
 )
 
-// setupWallet handles the creation or loading of the wallet.
-func setupWallet(walletPath string) (*mcp.Wallet, error) {
-	log.Println("Initiating wallet setup...")
+// Build information, injected by the Makefile through -ldflags
+var (
+	BuildVersion = "dev"
+	BuildDate    = "unknown"
+)
 
-	walletPassword := os.Getenv("WALLET_PASSWORD")
-	if walletPassword == "" {
-		return nil, fmt.Errorf("WALLET_PASSWORD environment variable not set. Please set it to secure your wallet")
+const (
+	defaultConfigPath = "config/mcp_manifest.yaml"
+	defaultWalletPath = "config/wallet.json"
+)
+
+// shutdownTimeout bounds how long in-flight calls may run after a shutdown signal
+const shutdownTimeout = 30 * time.Second
+
+// errReported is returned by a command that has already printed why it
+// failed; main then exits with status 1 without logging it again
+var errReported = errors.New("command failed")
+
+// setupWallet handles the creation or loading of the wallet
+func setupWallet(walletPath, passwordFile string) (*mcp.Wallet, error) {
+	slog.Debug("Initiating wallet setup")
+
+	walletPassword, err := readWalletPassword(passwordFile)
+	if err != nil {
+		return nil, err
 	}
-	log.Println("WALLET_PASSWORD environment variable found.")
 
-	log.Printf("Attempting to load or create wallet from %s...", walletPath)
+	slog.Debug("Loading or creating wallet", "path", walletPath)
 	wallet, err := mcp.GetOrCreateWallet(walletPath, walletPassword)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get or create wallet: %w", err)
 	}
 
-	log.Printf("Wallet loaded successfully. Address: %s", wallet.Address.Hex())
-	log.Println("Wallet setup complete.")
+	slog.Debug("Wallet loaded", "address", wallet.Address.Hex())
 	return wallet, nil
 }
 
+// fetchConfig returns the settings used to fetch a module given on the
+// command line. CIDs are fetched through the manifest's Lassie settings, or
+// a local Lassie daemon when the manifest has none; local files need no
+// manifest at all.
+func fetchConfig(configPath string) (*mcp.Config, error) {
+	config := &mcp.Config{}
+	if loaded, err := mcp.LoadConfig(configPath); err == nil {
+		config = loaded
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	config.IPFS.Enable = true
+	if config.IPFS.LassieNet.Host == "" {
+		config.IPFS.LassieNet = mcp.LassieNet{Scheme: "http", Host: "127.0.0.1", Port: 31999}
+	}
+	return config, nil
+}
+
+// readWalletPassword reads the wallet password from passwordFile when
+// given, otherwise from WALLET_PASSWORD
+func readWalletPassword(passwordFile string) (string, error) {
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read wallet password file: %w", err)
+		}
+		walletPassword := strings.TrimRight(string(data), "\r\n")
+		if walletPassword == "" {
+			return "", fmt.Errorf("wallet password file %s is empty", passwordFile)
+		}
+		slog.Debug("Wallet password read from file", "path", passwordFile)
+		return walletPassword, nil
+	}
+	walletPassword := os.Getenv("WALLET_PASSWORD")
+	if walletPassword == "" {
+		return "", fmt.Errorf("WALLET_PASSWORD environment variable not set. Please set it or pass --wallet-password-file to secure your wallet")
+	}
+	slog.Debug("Wallet password read from WALLET_PASSWORD")
+	return walletPassword, nil
+}
+
+// runOpenAPI writes the OpenAPI document of the manifest's tools
+func runOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "path to the module manifest")
+	output := fs.String("o", "", "write the document to this file instead of stdout")
+	fs.Parse(args)
+
+	config, err := mcp.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	doc, err := mcp.GenerateOpenAPI(config.Modules)
+	if err != nil {
+		return fmt.Errorf("failed to generate OpenAPI document: %w", err)
+	}
+	doc = append(doc, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(doc)
+		return err
+	}
+	return os.WriteFile(*output, doc, 0644)
+}
+
+// runHashKey prints the manifest hash of an API key read from stdin, or
+// of a new random key
+func runHashKey(args []string) error {
+	fs := flag.NewFlagSet("hash-key", flag.ExitOnError)
+	generate := fs.Bool("generate", false, "generate a new random key instead of reading one from stdin")
+	fs.Parse(args)
+
+	var key string
+	if *generate {
+		var err error
+		if key, err = mcp.GenerateAPIKey(); err != nil {
+			return fmt.Errorf("failed to generate API key: %w", err)
+		}
+		fmt.Printf("key:  %s\n", key)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read API key: %w", err)
+		}
+		if key = strings.TrimRight(line, "\r\n"); key == "" {
+			return errors.New("no API key on stdin")
+		}
+	}
+	fmt.Printf("hash: %s\n", mcp.HashAPIKey(key))
+	return nil
+}
+
+const usageText = `Usage: %[1]s <command> [flags]
+
+Commands:
+  serve        Run the MCP server (default when no command is given)
+  validate     Check a manifest and report every problem with its line number
+  inspect      List the exports and imports of a WASM file or CID
+  openapi      Write the OpenAPI document of a manifest's tools
+  hash-key     Hash an API key for the manifest's auth.api_keys
+  verify       Check the signature of a tool call receipt
+  sign-module  Sign a WASM module as its publisher with the wallet
+  version      Print build information
+
+Run "%[1]s <command> -h" for the flags of a command.
+`
+
+func usage() {
+	fmt.Fprintf(os.Stderr, usageText, os.Args[0])
+}
+
 func main() {
+	mcp.Version = BuildVersion
+
+	// Flags without a command run the server, as older versions did
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = runServe(args)
+	case "validate":
+		err = runValidate(args)
+	case "inspect":
+		err = runInspect(args)
+	case "openapi":
+		err = runOpenAPI(args)
+	case "hash-key":
+		err = runHashKey(args)
+	case "verify":
+		err = runVerify(args)
+	case "sign-module":
+		err = runSignModule(args)
+	case "version":
+		runVersion()
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if errors.Is(err, errReported) {
+		os.Exit(1)
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", cmd, "error", err)
+		os.Exit(1)
+	}
+}
+
+// runServe starts the MCP server and blocks until it is shut down
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "path to the module manifest")
+	walletPath := fs.String("wallet", defaultWalletPath, "path to the encrypted wallet, created if missing")
+	passwordFile := fs.String("wallet-password-file", "", "read the wallet password from this file instead of WALLET_PASSWORD")
+	listen := fs.String("listen", "", "host:port to listen on, overriding the manifest's host and port")
+	transport := fs.String("transport", "http", "MCP transport: http, or stdio to be launched by an MCP host")
+	logLevel := fs.String("log-level", "", "log verbosity: debug, info, warn or error (default: the manifest's logging.level, else info)")
+	logFormat := fs.String("log-format", "", "log format: text or json (default: the manifest's logging.format, else text)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *transport != "http" && *transport != "stdio" {
+		return fmt.Errorf("unsupported transport %q (want http or stdio)", *transport)
+	}
+
+	// The manifest configures logging, so it is read before anything logs
+	config, err := mcp.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to create MCP server: %w", err)
+	}
+	if err := setupLogging(config.Logging, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
 	// Create a context that will be canceled on interrupt
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -43,46 +246,120 @@ func main() {
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigCh
-		log.Println("Received shutdown signal, gracefully shutting down...")
+		slog.Info("Received shutdown signal, gracefully shutting down")
 		cancel()
 	}()
 
 	// Wallet setup
-	wallet, err := setupWallet("config/wallet.json")
+	wallet, err := setupWallet(*walletPath, *passwordFile)
 	if err != nil {
-		log.Fatalf("Wallet setup failed: %v", err)
+		return fmt.Errorf("wallet setup failed: %w", err)
 	}
-	log.Printf("Server is using wallet address: %s", wallet.Address.Hex())
+	slog.Info("Server is using wallet", "address", wallet.Address.Hex())
 
 	// Create and start the server
-	server, err := mcp.NewServer("config/mcp_manifest.yaml")
-	if err != nil {
-		log.Fatalf("Failed to create MCP server: %v", err)
+	server := mcp.NewServerFromConfig(config, *configPath)
+	server.SetWallet(wallet)
+	if *listen != "" {
+		if err := server.SetListenAddr(*listen); err != nil {
+			return err
+		}
 	}
 
-	log.Printf("MCP server created successfully with config: %s", "config/mcp_manifest.yaml")
-	log.Printf("Server info: %+v", server)
+	slog.Info("MCP server created", "config", *configPath)
 
-	// Start the server in a goroutine
+	// Start the server in a goroutine. Over stdio the server exits when
+	// the host closes stdin; the stream gets its own context so that a
+	// shutdown signal lets in-flight calls finish.
 	go func() {
-		if err := server.Start(); err != nil {
-			log.Printf("MCP server failed: %v", err)
-			cancel()
+		var err error
+		if *transport == "stdio" {
+			err = server.ServeStdio(context.Background())
+		} else {
+			err = server.Start()
+		}
+		if err != nil {
+			slog.Error("MCP server failed", "error", err)
+		}
+		cancel()
+	}()
+
+	slog.Info("MCP server started and running")
+
+	// Reload the manifest when it or a local WASM module changes on disk
+	go func() {
+		if err := server.Watch(ctx); err != nil {
+			slog.Error("Config watcher stopped", "error", err)
 		}
 	}()
 
-	log.Println("MCP server started and running")
+	// Reload the manifest on SIGHUP
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			slog.Info("Received SIGHUP, reloading configuration")
+			if err := server.Reload(ctx); err != nil {
+				slog.Error("Reload failed", "error", err)
+			}
+		}
+	}()
 
 	// Wait for context cancellation
 	<-ctx.Done()
-	log.Println("Shutting down MCP server")
+	slog.Info("Shutting down MCP server")
 
 	// Gracefully stop the server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
 	if err := server.Stop(shutdownCtx); err != nil {
-		log.Printf("Error during server shutdown: %v", err)
+		return fmt.Errorf("error during server shutdown: %w", err)
+	}
+	return nil
+}
+
+// runValidate lints a manifest without starting anything
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "path to the module manifest")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [flags] [manifest]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	path := *configPath
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		path = fs.Arg(0)
+	default:
+		fs.Usage()
+		return errors.New("expected at most one manifest")
+	}
+
+	config, err := mcp.LoadConfig(path)
+	if err != nil {
+		var cfgErr *mcp.ConfigError
+		if errors.As(err, &cfgErr) {
+			// The problem list is the output of this command
+			fmt.Fprintln(os.Stderr, cfgErr)
+			return errReported
+		}
+		return err
 	}
+
+	tools := 0
+	for _, module := range config.Modules {
+		tools += len(module.Tools)
+	}
+	fmt.Printf("%s: OK (%d modules, %d tools)\n", path, len(config.Modules), tools)
+	return nil
 }
 
+// runVersion prints the build information
+func runVersion() {
+	fmt.Printf("DANP-MCP-SERVER %s\n", BuildVersion)
+	fmt.Printf("Built:   %s\n", BuildDate)
+	fmt.Printf("Go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DANP-LABS/DANP-Engine/core/mcp"
+	"github.com/DANP-LABS/DANP-Engine/pkg/mcpclient"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+)
+
+const stdioManifest = `signature_policy: "off"
+modules:
+  - name: "hello"
+    wasm_path: "file://%s"
+    tools:
+      - name: "say_hello"
+        description: "Greet someone by name"
+        input_mode: "single_arg_raw"
+        input_arg: "name"
+        inputs:
+          - name: "name"
+            type: "string"
+            required: true
+`
+
+// testBuildVersion is injected into the test binary the way the Makefile
+// injects the commit hash
+const testBuildVersion = "test-build"
+
+// TestServeStdio launches the server binary the way an MCP host does and
+// calls a tool over its stdin and stdout
+func TestServeStdio(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and launches the server binary")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "DANP-MCP-SERVER")
+	if out, err := exec.Command("go", "build", "-ldflags", "-X main.BuildVersion="+testBuildVersion, "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	wasm, err := filepath.Abs("../../wasm-examples/say_hello/say_hello.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "manifest.yaml")
+	if err := os.WriteFile(manifest, fmt.Appendf(nil, stdioManifest, wasm), 0644); err != nil {
+		t.Fatal(err)
+	}
+	password := filepath.Join(dir, "password")
+	if err := os.WriteFile(password, []byte("test-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	command := fmt.Sprintf("%s serve --transport stdio --log-level error --config %s --wallet %s --wallet-password-file %s",
+		bin, manifest, filepath.Join(dir, "wallet.json"), password)
+	client, err := mcpclient.NewClient(ctx, command, "")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	initialized, err := client.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if version := initialized.ServerInfo.Version; version != testBuildVersion {
+		t.Errorf("server reports version %q, want the build version %q", version, testBuildVersion)
+	}
+	tools, err := mcpclient.NewToolManager(client).ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "say_hello" {
+		t.Fatalf("tools = %v, want say_hello", tools)
+	}
+
+	result, err := client.GetRawClient().CallTool(ctx, mcpgo.CallToolRequest{
+		Params: mcpgo.CallToolParams{Name: "say_hello", Arguments: map[string]any{"name": "stdio"}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if result.IsError || len(result.Content) == 0 {
+		t.Fatalf("say_hello returned %+v", result)
+	}
+	if text, ok := result.Content[0].(mcpgo.TextContent); !ok || text.Text != "Hello, stdio!" {
+		t.Errorf("say_hello answered %+v, want Hello, stdio!", result.Content[0])
+	}
+}
+
+func TestFetchConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	config, err := fetchConfig(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatalf("without a manifest: %v", err)
+	}
+	if !config.IPFS.Enable || config.IPFS.LassieNet.Host != "127.0.0.1" || config.IPFS.LassieNet.Port != 31999 {
+		t.Errorf("without a manifest: ipfs %+v, want the local Lassie daemon", config.IPFS)
+	}
+
+	manifest := filepath.Join(dir, "manifest.yaml")
+	if err := os.WriteFile(manifest, []byte("ipfs:\n  enable: false\n  lassie_net: {scheme: https, host: lassie.example.com, port: 443}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = fetchConfig(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.IPFS.Enable || config.IPFS.LassieNet.Host != "lassie.example.com" {
+		t.Errorf("ipfs %+v, want the manifest's Lassie settings enabled", config.IPFS)
+	}
+
+	if err := os.WriteFile(manifest, []byte("bogus: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchConfig(manifest); err == nil {
+		t.Error("invalid manifest accepted")
+	}
+}
+
+// TestSignModule checks that the signature sign-module writes recovers to
+// the wallet it signed with
+func TestSignModule(t *testing.T) {
+	dir := t.TempDir()
+	walletPath := filepath.Join(dir, "publisher.json")
+	wallet, err := mcp.GetOrCreateWallet(walletPath, "test-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := filepath.Join(dir, "password")
+	if err := os.WriteFile(password, []byte("test-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wasm := "../../wasm-examples/say_hello/say_hello.wasm"
+	output := filepath.Join(dir, "say_hello.wasm.sig")
+
+	err = runSignModule([]string{"-config", filepath.Join(dir, "missing.yaml"), "-wallet", walletPath,
+		"-wallet-password-file", password, "-o", output, wasm})
+	if err != nil {
+		t.Fatalf("sign-module: %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := mcp.ParseModuleSignature(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := mcp.FetchWASM(context.Background(), &mcp.Config{}, wasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher, err := mcp.RecoverModulePublisher(files, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publisher != wallet.Address {
+		t.Errorf("signature recovers to %s, want the wallet %s", publisher.Hex(), wallet.Address.Hex())
+	}
+}
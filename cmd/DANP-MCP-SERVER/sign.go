@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/DANP-LABS/DANP-Engine/core/mcp"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// runSignModule signs the content hash of a WASM module, given as a file
+// path, file:// URL, IPFS:// URL or bare CID, with the keystore wallet
+func runSignModule(args []string) error {
+	fs := flag.NewFlagSet("sign-module", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "manifest whose ipfs settings are used to fetch CIDs")
+	walletPath := fs.String("wallet", defaultWalletPath, "path to the encrypted wallet of the publisher")
+	passwordFile := fs.String("wallet-password-file", "", "read the wallet password from this file instead of WALLET_PASSWORD")
+	output := fs.String("o", "", "also write the signature to this file, e.g. module.wasm.sig")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s sign-module [flags] <wasm-file|cid>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one WASM file or CID")
+	}
+	target := fs.Arg(0)
+
+	password, err := readWalletPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+	// Signing must not silently create a new publisher identity
+	wallet, err := mcp.LoadWallet(*walletPath, password)
+	if err != nil {
+		return fmt.Errorf("failed to load wallet: %w", err)
+	}
+
+	config, err := fetchConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := mcp.FetchWASM(context.Background(), config, target)
+	if err != nil {
+		return err
+	}
+	signature, err := wallet.SignModule(files)
+	if err != nil {
+		return err
+	}
+	encoded := hexutil.Encode(signature)
+
+	fmt.Printf("Module:    %s\n", target)
+	fmt.Printf("SHA-256:   %x\n", mcp.ModuleContentHash(files))
+	fmt.Printf("Publisher: %s\n", wallet.Address.Hex())
+	fmt.Printf("Signature: %s\n", encoded)
+	if *output != "" {
+		if err := os.WriteFile(*output, []byte(encoded+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write signature: %w", err)
+		}
+	}
+	return nil
+}
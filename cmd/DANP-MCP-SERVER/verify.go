@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DANP-LABS/DANP-Engine/core/mcp"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runVerify checks the signature of an execution receipt and, optionally,
+// that it covers a given call, node and module
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	argsPath := fs.String("args", "", "JSON file of the call arguments to check against the input hash")
+	outputPath := fs.String("output", "", "file of the tool output to check against the output hash")
+	node := fs.String("node", "", "address the receipt must be signed by")
+	moduleCID := fs.String("module-cid", "", "CID the module must have been loaded from")
+	moduleSHA := fs.String("module-sha256", "", "hex content hash the module must have, as sign-module prints it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s verify [flags] <receipt-file|->\n\n"+
+			"The receipt is the JSON of a result's _meta or the value of an X-DANP-Receipt header.\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one receipt file, or - for stdin")
+	}
+
+	data, err := readInput(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read receipt: %w", err)
+	}
+	receipt, err := mcp.ParseReceipt(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Module:    %s\n", receipt.Module)
+	if receipt.ModuleCID != "" {
+		fmt.Printf("CID:       %s\n", receipt.ModuleCID)
+	}
+	fmt.Printf("SHA-256:   %s\n", receipt.ModuleSHA256)
+	fmt.Printf("Tool:      %s\n", receipt.Tool)
+	fmt.Printf("Input:     %s\n", receipt.InputHash)
+	fmt.Printf("Output:    %s\n", receipt.OutputHash)
+	fmt.Printf("Timestamp: %s\n", receipt.Timestamp.Format(time.RFC3339Nano))
+	fmt.Printf("Node:      %s\n", receipt.Node.Hex())
+
+	if err := mcp.VerifyReceipt(receipt); err != nil {
+		return fmt.Errorf("invalid receipt: %w", err)
+	}
+
+	var problems []string
+	if *node != "" {
+		if !common.IsHexAddress(*node) {
+			return fmt.Errorf("invalid node address %q", *node)
+		}
+		if common.HexToAddress(*node) != receipt.Node {
+			problems = append(problems, fmt.Sprintf("receipt is signed by %s, not %s", receipt.Node.Hex(), *node))
+		}
+	}
+	if *moduleCID != "" && *moduleCID != receipt.ModuleCID {
+		problems = append(problems, fmt.Sprintf("module was loaded from %q, not %s", receipt.ModuleCID, *moduleCID))
+	}
+	if *moduleSHA != "" && !strings.EqualFold(*moduleSHA, receipt.ModuleSHA256) {
+		problems = append(problems, fmt.Sprintf("module SHA-256 is %s, not %s", receipt.ModuleSHA256, *moduleSHA))
+	}
+	if *argsPath != "" {
+		data, err := readInput(*argsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read arguments: %w", err)
+		}
+		var callArgs map[string]any
+		if err := json.Unmarshal(data, &callArgs); err != nil {
+			return fmt.Errorf("arguments must be a JSON object: %w", err)
+		}
+		hash, err := mcp.HashArguments(callArgs)
+		if err != nil {
+			return err
+		}
+		if hash != receipt.InputHash {
+			problems = append(problems, "arguments do not match the input hash")
+		}
+	}
+	if *outputPath != "" {
+		output, err := readInput(*outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to read output: %w", err)
+		}
+		if mcp.HashOutput(output) != receipt.OutputHash {
+			problems = append(problems, "output does not match the output hash")
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	fmt.Println("Signature: valid")
+	return nil
+}
+
+// readInput reads a file, or stdin for "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
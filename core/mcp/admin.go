@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxAdminBody bounds the size of an admin request body
+const maxAdminBody = 1 << 20
+
+// loadModuleRequest is the body of POST /admin/modules: a module definition
+// in manifest form, as JSON or YAML. CID is shorthand for an IPFS:// wasm_path.
+type loadModuleRequest struct {
+	Module `yaml:",inline"`
+	CID    string `yaml:"cid"`
+}
+
+// registerAdminRoutes mounts the admin API on mux
+func (s *MCPServer) registerAdminRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /admin/modules", s.adminAuth(http.HandlerFunc(s.handleListModules)))
+	mux.Handle("POST /admin/modules", s.adminAuth(http.HandlerFunc(s.handleLoadModule)))
+	mux.Handle("GET /admin/modules/{name}", s.adminAuth(http.HandlerFunc(s.handleGetModule)))
+	mux.Handle("DELETE /admin/modules/{name}", s.adminAuth(http.HandlerFunc(s.handleUnloadModule)))
+	mux.Handle("POST /admin/modules/{name}/reload", s.adminAuth(http.HandlerFunc(s.handleReloadModule)))
+	mux.Handle("POST /admin/reload", s.adminAuth(http.HandlerFunc(s.handleReload)))
+}
+
+// adminToken resolves the configured admin token, if any
+func (s *MCPServer) adminToken() string {
+	admin := s.currentConfig().Admin
+	if admin.TokenEnv != "" {
+		if token := os.Getenv(admin.TokenEnv); token != "" {
+			return token
+		}
+	}
+	return admin.Token
+}
+
+// adminAuth requires the admin bearer token, or a loopback client when no
+// token is configured
+func (s *MCPServer) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := s.adminToken()
+		if token == "" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+				slog.WarnContext(r.Context(), "Rejected admin request: no admin token configured", "remote_addr", r.RemoteAddr)
+				writeAdminError(w, http.StatusForbidden, errors.New("admin API is only available from loopback"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			slog.WarnContext(r.Context(), "Rejected admin request: invalid token", "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminError(w, http.StatusUnauthorized, errors.New("invalid or missing admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *MCPServer) handleListModules(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"modules": s.ListModules(),
+	})
+}
+
+func (s *MCPServer) handleGetModule(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.Module(r.PathValue("name"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrModuleNotFound, r.PathValue("name")))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, info)
+}
+
+func (s *MCPServer) handleLoadModule(w http.ResponseWriter, r *http.Request) {
+	var req loadModuleRequest
+	decoder := yaml.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid module definition: %w", err))
+		return
+	}
+	module := req.Module
+	if req.CID != "" {
+		if module.WASMPath != "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("set either wasm_path or cid, not both"))
+			return
+		}
+		module.WASMPath = "IPFS://" + req.CID
+	}
+
+	slog.InfoContext(r.Context(), "Admin request to load module", "module", module.Name, "wasm_path", module.WASMPath)
+	if err := s.LoadModule(r.Context(), module); err != nil {
+		writeAdminError(w, adminStatus(err), err)
+		return
+	}
+	info, _ := s.Module(module.Name)
+	writeAdminJSON(w, http.StatusCreated, info)
+}
+
+func (s *MCPServer) handleUnloadModule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	slog.InfoContext(r.Context(), "Admin request to unload module", "module", name)
+	if err := s.UnloadModule(r.Context(), name); err != nil {
+		writeAdminError(w, adminStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *MCPServer) handleReloadModule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	slog.InfoContext(r.Context(), "Admin request to reload module", "module", name)
+	if err := s.ReloadModule(r.Context(), name); err != nil {
+		writeAdminError(w, adminStatus(err), err)
+		return
+	}
+	info, _ := s.Module(name)
+	writeAdminJSON(w, http.StatusOK, info)
+}
+
+func (s *MCPServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "Admin request to reload the manifest")
+	if err := s.Reload(r.Context()); err != nil {
+		writeAdminError(w, adminStatus(err), err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"modules": s.ListModules(),
+	})
+}
+
+// adminStatus maps a module management error onto an HTTP status
+func adminStatus(err error) int {
+	var cfgErr *ConfigError
+	switch {
+	case errors.As(err, &cfgErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrModuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrModuleConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
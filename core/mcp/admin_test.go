@@ -0,0 +1,160 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// adminRequest serves one admin API request from remoteAddr
+func adminRequest(t *testing.T, mux *http.ServeMux, method, path, remoteAddr, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	const (
+		loopback = "127.0.0.1:40000"
+		remote   = "192.0.2.1:40000"
+	)
+	tests := []struct {
+		name       string
+		token      string // configured admin token
+		remoteAddr string
+		bearer     string
+		want       int
+	}{
+		{name: "no token configured, loopback", remoteAddr: loopback, want: http.StatusOK},
+		{name: "no token configured, IPv6 loopback", remoteAddr: "[::1]:40000", want: http.StatusOK},
+		{name: "no token configured, remote", remoteAddr: remote, want: http.StatusForbidden},
+		{name: "no token configured, remote with bearer", remoteAddr: remote, bearer: "secret", want: http.StatusForbidden},
+		{name: "missing bearer", token: "secret", remoteAddr: loopback, want: http.StatusUnauthorized},
+		{name: "wrong bearer", token: "secret", remoteAddr: loopback, bearer: "guess", want: http.StatusUnauthorized},
+		{name: "valid bearer, remote", token: "secret", remoteAddr: remote, bearer: "secret", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMCPServer(&Config{SignaturePolicy: SignaturePolicyOff, Admin: AdminConfig{Token: tt.token}})
+			mux := http.NewServeMux()
+			s.registerAdminRoutes(mux)
+
+			w := adminRequest(t, mux, http.MethodGet, "/admin/modules", tt.remoteAddr, tt.bearer, "")
+			if w.Code != tt.want {
+				t.Errorf("GET /admin/modules: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAdminTokenFromEnv(t *testing.T) {
+	t.Setenv("TEST_ADMIN_TOKEN", "from-env")
+	s := NewMCPServer(&Config{SignaturePolicy: SignaturePolicyOff, Admin: AdminConfig{Token: "inline", TokenEnv: "TEST_ADMIN_TOKEN"}})
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+
+	if w := adminRequest(t, mux, http.MethodGet, "/admin/modules", "192.0.2.1:40000", "inline", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("inline token: %d, want it shadowed by the environment", w.Code)
+	}
+	if w := adminRequest(t, mux, http.MethodGet, "/admin/modules", "192.0.2.1:40000", "from-env", ""); w.Code != http.StatusOK {
+		t.Errorf("environment token: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminModuleLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	testModuleFiles(t, dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	writeManifest(t, path, loopManifest("1s"))
+	s := newManifestServer(t, path)
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+
+	do := func(method, path, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := adminRequest(t, mux, method, path, "127.0.0.1:40000", "", body)
+		if w.Code != want {
+			t.Fatalf("%s %s: %d %s, want %d", method, path, w.Code, w.Body, want)
+		}
+		return w
+	}
+	modules := func() map[string]ModuleInfo {
+		t.Helper()
+		var body struct {
+			Modules []ModuleInfo `json:"modules"`
+		}
+		if err := json.Unmarshal(do(http.MethodGet, "/admin/modules", "", http.StatusOK).Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		byName := make(map[string]ModuleInfo)
+		for _, info := range body.Modules {
+			byName[info.Name] = info
+		}
+		return byName
+	}
+
+	hog := `{"name": "hog", "wasm_path": "file://` + filepath.Join(dir, "hog.wasm") + `", "tools": [{"name": "grow"}, {"name": "trap"}]}`
+	var loaded ModuleInfo
+	if err := json.Unmarshal(do(http.MethodPost, "/admin/modules", hog, http.StatusCreated).Body.Bytes(), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Status != ModuleLoaded || loaded.Origin != OriginAdmin {
+		t.Errorf("loaded module %+v", loaded)
+	}
+	if info, ok := modules()["hog"]; !ok || strings.Join(info.Tools, ",") != "grow,trap" {
+		t.Errorf("GET /admin/modules lists hog as %+v", info)
+	}
+	if s.server.GetTool("grow") == nil {
+		t.Error("admin module's tools were not registered")
+	}
+
+	// Loading the same module twice, or another module with a tool already
+	// served, conflicts
+	do(http.MethodPost, "/admin/modules", hog, http.StatusConflict)
+	twin := strings.Replace(hog, `"name": "hog"`, `"name": "twin"`, 1)
+	do(http.MethodPost, "/admin/modules", twin, http.StatusConflict)
+	manifestTool := `{"name": "twin", "wasm_path": "file://` + filepath.Join(dir, "loop.wasm") + `", "tools": [{"name": "ok"}]}`
+	do(http.MethodPost, "/admin/modules", manifestTool, http.StatusConflict)
+	if _, ok := modules()["twin"]; ok {
+		t.Error("conflicting module was recorded")
+	}
+	do(http.MethodPost, "/admin/modules", `{"name": "bad", "bogus": 1}`, http.StatusBadRequest)
+
+	plugin, _ := s.wasmEngine.Plugin("hog")
+	do(http.MethodPost, "/admin/modules/hog/reload", "", http.StatusOK)
+	if reloaded, _ := s.wasmEngine.Plugin("hog"); reloaded == plugin {
+		t.Error("reloading a module kept its plugin")
+	}
+
+	// An admin module survives a manifest reload
+	do(http.MethodPost, "/admin/reload", "", http.StatusOK)
+	if _, ok := modules()["hog"]; !ok {
+		t.Error("manifest reload unloaded the admin module")
+	}
+
+	do(http.MethodDelete, "/admin/modules/hog", "", http.StatusNoContent)
+	if _, ok := modules()["hog"]; ok {
+		t.Error("unloaded module is still listed")
+	}
+	if s.server.GetTool("grow") != nil {
+		t.Error("unloaded module's tools are still registered")
+	}
+
+	do(http.MethodGet, "/admin/modules/hog", "", http.StatusNotFound)
+	do(http.MethodDelete, "/admin/modules/hog", "", http.StatusNotFound)
+	do(http.MethodPost, "/admin/modules/hog/reload", "", http.StatusNotFound)
+	do(http.MethodGet, "/admin/modules/loop", "", http.StatusOK)
+}
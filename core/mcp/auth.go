@@ -0,0 +1,334 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Authentication methods reported in Principal.Method
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+)
+
+// apiKeyHeader carries an API key as an alternative to a bearer token
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyHashPrefix names the hash of api_keys[].hash
+const apiKeyHashPrefix = "sha256:"
+
+// AuthConfig turns on authentication of the MCP transports, the REST
+// gateway and the OpenAPI document as soon as any method is configured.
+// The health probes, the wallet sign-in endpoints and the admin API, which
+// has its own token, stay open. /metrics stays open only with
+// metrics.public: true.
+type AuthConfig struct {
+	APIKeys []APIKeyConfig   `yaml:"api_keys"`
+	JWT     JWTConfig        `yaml:"jwt"`
+	Wallet  WalletAuthConfig `yaml:"wallet"`
+}
+
+// APIKeyConfig is a static API key. Only the hash of the key is stored,
+// as "sha256:" followed by the hex digest; HashAPIKey computes it.
+type APIKeyConfig struct {
+	Principal string   `yaml:"principal"`
+	Hash      string   `yaml:"hash"`
+	Scopes    []string `yaml:"scopes"`
+}
+
+// enabled reports whether any authentication method is configured
+func (c AuthConfig) enabled() bool {
+	return len(c.APIKeys) > 0 || c.JWT.enabled() || c.Wallet.Enable
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name   string         `json:"name"`
+	Method string         `json:"method"`
+	Scopes []string       `json:"scopes,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// ID names the principal as allowed_principals does, by its method and
+// name, as in api_key:ci-bot or wallet:0x31b8...
+func (p *Principal) ID() string {
+	return p.Method + ":" + p.Name
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Authenticator verifies the credentials of an HTTP request. It returns a
+// nil principal and a nil error when the request carries no credentials
+// it understands, leaving the request to the next authenticator; an error
+// rejects the request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context that carries the authenticated caller
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller a tool handler runs for, if the
+// request was authenticated
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// HashAPIKey returns the value of api_keys[].hash for key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return apiKeyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "danp_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AddAuthenticator plugs in an authenticator of its own, tried after the
+// methods of the manifest. Once one is added every protected request must
+// authenticate.
+func (s *MCPServer) AddAuthenticator(a Authenticator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customAuth = append(s.customAuth, a)
+}
+
+// authenticators returns the manifest's authenticators followed by the
+// custom ones
+func (s *MCPServer) authenticators() []Authenticator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append(slices.Clip(s.configAuth), s.customAuth...)
+}
+
+// newConfigAuthenticators builds the authenticators of the auth block.
+// Wallet sessions come first: their tokens are opaque, like API keys, but
+// carry a prefix the wallet authenticator claims.
+func newConfigAuthenticators(cfg AuthConfig, wallet *walletAuthenticator) []Authenticator {
+	var authenticators []Authenticator
+	if cfg.Wallet.Enable {
+		authenticators = append(authenticators, wallet)
+	}
+	if len(cfg.APIKeys) > 0 {
+		authenticators = append(authenticators, newAPIKeyAuthenticator(cfg.APIKeys))
+	}
+	if cfg.JWT.enabled() {
+		authenticators = append(authenticators, newJWTAuthenticator(cfg.JWT))
+	}
+	return authenticators
+}
+
+// requireAuth admits requests that an authenticator accepts, with the
+// principal in their context. Without any authenticator every request is
+// admitted unauthenticated.
+func (s *MCPServer) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticators := s.authenticators()
+		if len(authenticators) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, a := range authenticators {
+			principal, err := a.Authenticate(r)
+			if err != nil {
+				slog.WarnContext(r.Context(), "Rejected request: invalid credentials", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+				writeAuthError(w, `Bearer realm="danp-engine", error="invalid_token"`, err)
+				return
+			}
+			if principal != nil {
+				ctx := WithPrincipal(r.Context(), principal)
+				slog.DebugContext(ctx, "Authenticated request", "method", principal.Method)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+		slog.InfoContext(r.Context(), "Rejected request: no credentials", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		writeAuthError(w, `Bearer realm="danp-engine"`, errors.New("authentication required"))
+	})
+}
+
+// optionalAuth identifies the caller when the request carries credentials
+// an authenticator accepts, and otherwise serves it anonymously
+func (s *MCPServer) optionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, a := range s.authenticators() {
+			principal, err := a.Authenticate(r)
+			if err != nil {
+				break
+			}
+			if principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), principal))
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAuthError(w http.ResponseWriter, challenge string, err error) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// looksLikeJWT tells a compact JWT apart from an opaque token
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// apiKeyAuthenticator accepts the configured API keys, sent in X-API-Key
+// or as an opaque bearer token
+type apiKeyAuthenticator struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	principal string
+	hash      []byte
+	scopes    []string
+}
+
+func newAPIKeyAuthenticator(keys []APIKeyConfig) *apiKeyAuthenticator {
+	a := &apiKeyAuthenticator{}
+	for _, key := range keys {
+		hash, err := hex.DecodeString(strings.TrimPrefix(key.Hash, apiKeyHashPrefix))
+		if err != nil {
+			// ParseConfig rejects such hashes; skip rather than match nothing
+			continue
+		}
+		a.keys = append(a.keys, apiKey{principal: key.Principal, hash: hash, scopes: key.Scopes})
+	}
+	return a
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	bearer := false
+	if key == "" {
+		token, ok := bearerToken(r)
+		if !ok || looksLikeJWT(token) {
+			return nil, nil
+		}
+		key, bearer = token, true
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	// Every key is compared so that the time taken does not reveal a match
+	var match *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].hash) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		// An opaque bearer token may belong to an authenticator added
+		// with AddAuthenticator
+		if bearer {
+			return nil, nil
+		}
+		return nil, errors.New("unknown API key")
+	}
+	return &Principal{
+		Name:   match.principal,
+		Method: AuthMethodAPIKey,
+		Scopes: slices.Clone(match.scopes),
+	}, nil
+}
+
+// authorizeTool checks the allowed_principals and scopes of a tool against
+// the caller in ctx
+func authorizeTool(ctx context.Context, tool Tool) *ToolError {
+	if len(tool.AllowedPrincipals) == 0 && len(tool.Scopes) == 0 {
+		return nil
+	}
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return newToolError(ErrCodeForbidden, "%s requires an authenticated caller", tool.Name)
+	}
+	if len(tool.AllowedPrincipals) > 0 && !slices.Contains(tool.AllowedPrincipals, principal.ID()) {
+		return newToolError(ErrCodeForbidden, "%s may not call %s", principal.ID(), tool.Name)
+	}
+	for _, scope := range tool.Scopes {
+		if !principal.HasScope(scope) {
+			return newToolError(ErrCodeForbidden, "%s requires scope %s", tool.Name, scope)
+		}
+	}
+	return nil
+}
+
+// restrictedTools lists the registered tools that name allowed principals
+// or scopes
+func (s *MCPServer) restrictedTools() []string {
+	var names []string
+	for name, tool := range s.wasmEngine.toolDefinitions() {
+		if len(tool.AllowedPrincipals) > 0 || len(tool.Scopes) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// visibleToolNames lists the registered tools the caller in ctx may call
+func (s *MCPServer) visibleToolNames(ctx context.Context) []string {
+	definitions := s.wasmEngine.toolDefinitions()
+	var names []string
+	for _, name := range s.toolNames() {
+		if def, ok := definitions[name]; ok && authorizeTool(ctx, def) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// filterTools hides the tools the caller may not call from tools/list
+func (w *WASMEngine) filterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	definitions := w.toolDefinitions()
+	visible := tools[:0:0]
+	for _, tool := range tools {
+		if def, ok := definitions[tool.Name]; ok && authorizeTool(ctx, def) != nil {
+			continue
+		}
+		visible = append(visible, tool)
+	}
+	return visible
+}
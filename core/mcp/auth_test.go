@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthorizeToolMatchesMethodAndName(t *testing.T) {
+	tool := Tool{Name: "validate_data", AllowedPrincipals: []string{"api_key:ci-bot", "wallet:0x31b8D97B4Bbd266545C6FFe2610876e747c2B030"}}
+	tests := []struct {
+		principal Principal
+		allowed   bool
+	}{
+		{Principal{Method: AuthMethodAPIKey, Name: "ci-bot"}, true},
+		{Principal{Method: AuthMethodAPIKey, Name: "CI-Bot"}, false},
+		{Principal{Method: AuthMethodJWT, Name: "ci-bot"}, false},
+		{Principal{Method: AuthMethodWallet, Name: "0x31b8D97B4Bbd266545C6FFe2610876e747c2B030"}, true},
+		{Principal{Method: AuthMethodWallet, Name: "ci-bot"}, false},
+	}
+	for _, tt := range tests {
+		ctx := WithPrincipal(context.Background(), &tt.principal)
+		if err := authorizeTool(ctx, tool); (err == nil) != tt.allowed {
+			t.Errorf("authorizeTool(%s) = %v, want allowed %v", tt.principal.ID(), err, tt.allowed)
+		}
+	}
+}
+
+func TestCheckPrincipalID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"api_key:ci-bot": true,
+		"jwt:user-42":    true,
+		"wallet:0x31b8D97B4Bbd266545C6FFe2610876e747c2B030": true,
+		"wallet:0x31b8d97b4bbd266545c6ffe2610876e747c2b030": false,
+		"wallet:ci-bot": false,
+		"ci-bot":        false,
+		":ci-bot":       false,
+		"api_key:":      false,
+	} {
+		if err := checkPrincipalID(id); (err == nil) != valid {
+			t.Errorf("checkPrincipalID(%q) = %v, want valid %v", id, err, valid)
+		}
+	}
+}
+
+// staticAuthenticator accepts one bearer token
+type staticAuthenticator struct{ token string }
+
+func (a staticAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if token, ok := bearerToken(r); ok && token == a.token {
+		return &Principal{Name: "custom", Method: "custom"}, nil
+	}
+	return nil, nil
+}
+
+func TestOpaqueBearerReachesCustomAuthenticators(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Auth:            AuthConfig{APIKeys: []APIKeyConfig{{Principal: "ci-bot", Hash: HashAPIKey(key)}}},
+	})
+	s.AddAuthenticator(staticAuthenticator{token: "opaque-session"})
+	handler := s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		fmt.Fprint(w, principal.ID())
+	}))
+
+	for _, tt := range []struct {
+		header, value string
+		status        int
+		body          string
+	}{
+		{"Authorization", "Bearer " + key, http.StatusOK, "api_key:ci-bot"},
+		{"Authorization", "Bearer opaque-session", http.StatusOK, "custom:custom"},
+		{"Authorization", "Bearer unknown", http.StatusUnauthorized, ""},
+		{"X-API-Key", "opaque-session", http.StatusUnauthorized, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/tools", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: %s gave %d %q, want %d %q", tt.header, tt.value, w.Code, w.Body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestJWKSFetchedOnceForConcurrentRequests(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"jwks_uri":"http://%s/jwks"}`, r.Host)
+		case "/jwks":
+			fetches.Add(1)
+			// Hold the fetch so that every request arrives while it runs
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(w, `{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":%q}]}`,
+				base64.RawURLEncoding.EncodeToString(public))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer issuer.Close()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub": "user-42",
+		"iss": issuer.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newJWTAuthenticator(JWTConfig{Issuer: issuer.URL})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/tools", nil)
+			r.Header.Set("Authorization", "Bearer "+signed)
+			principal, err := a.Authenticate(r)
+			if err != nil || principal == nil || principal.ID() != "jwt:user-42" {
+				t.Errorf("Authenticate: %v, %v", principal, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
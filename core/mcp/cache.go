@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/DANP-LABS/DANP-Engine/pkg/ipfs"
+)
+
+// moduleCaches holds the open module caches by directory, so every client
+// of a server shares one size bound and one view of recency
+var moduleCaches = struct {
+	mu     sync.Mutex
+	caches map[string]*ipfs.Cache
+}{caches: make(map[string]*ipfs.Cache)}
+
+// moduleCache returns the cache configured in ipfs.cache, or nil when
+// there is none or it cannot be opened
+func moduleCache(cfg IPFSConfig) *ipfs.Cache {
+	if cfg.Cache.Dir == "" {
+		return nil
+	}
+	moduleCaches.mu.Lock()
+	defer moduleCaches.mu.Unlock()
+	if cache, ok := moduleCaches.caches[cfg.Cache.Dir]; ok {
+		return cache
+	}
+	cache, err := ipfs.OpenCache(cfg.Cache.Dir, cfg.Cache.MaxBytes)
+	if err != nil {
+		slog.Error("Failed to open module cache, retrieving without it", "dir", cfg.Cache.Dir, "error", err)
+		return nil
+	}
+	slog.Info("Opened module cache", "dir", cfg.Cache.Dir)
+	moduleCaches.caches[cfg.Cache.Dir] = cache
+	return cache
+}
+
+// newIPFSClient creates a client of the manifest's gateway that goes
+// through the module cache, reporting retrievals to observe
+func newIPFSClient(config *Config, observe ipfs.RetrieveObserver) *ipfs.Client {
+	client := ipfs.NewClient(config.IPFS.LassieNet.Scheme,
+		config.IPFS.LassieNet.Host,
+		config.IPFS.LassieNet.Port,
+		0) // Default timeout
+	client.SetRetrieveObserver(observe)
+	client.SetCache(moduleCache(config.IPFS))
+	client.SetOffline(config.IPFS.Offline)
+	client.SetMaxResponseBytes(config.IPFS.MaxResponseBytes)
+	return client
+}
+
+// prefetchCIDs retrieves the manifest's ipfs.cids into the module cache so
+// that modules loaded from them later need not wait for the gateway
+func (s *MCPServer) prefetchCIDs(ctx context.Context, config *Config) {
+	if !config.IPFS.Enable || len(config.IPFS.CIDS) == 0 {
+		return
+	}
+	if config.IPFS.Cache.Dir == "" {
+		slog.WarnContext(ctx, "ipfs.cids are only prefetched when ipfs.cache.dir is set", "cids", len(config.IPFS.CIDS))
+		return
+	}
+	client := newIPFSClient(config, s.wasmEngine.Metrics().observeIPFSRetrieve)
+	fetched := 0
+	for _, cid := range config.IPFS.CIDS {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := client.RetrieveContext(ctx, cid); err != nil {
+			slog.WarnContext(ctx, "Failed to prefetch CID", "cid", cid, "error", err)
+			continue
+		}
+		slog.DebugContext(ctx, "Prefetched CID", "cid", cid)
+		fetched++
+	}
+	slog.InfoContext(ctx, "Prefetched IPFS CIDs", "fetched", fetched, "cids", len(config.IPFS.CIDS))
+}
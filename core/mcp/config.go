@@ -0,0 +1,594 @@
+package mcp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ipfs/go-cid"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigProblem is a single issue found while loading a manifest
+type ConfigProblem struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+// String renders the problem as "line N: path: message"
+func (p ConfigProblem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	if p.Path != "" {
+		fmt.Fprintf(&b, "%s: ", p.Path)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ConfigError reports every problem found in a manifest
+type ConfigError struct {
+	File     string
+	Problems []ConfigProblem
+}
+
+// Error implements the error interface, listing one problem per line
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	name := e.File
+	if name == "" {
+		name = "config"
+	}
+	fmt.Fprintf(&b, "%s: %d problem(s) found", name, len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// LoadConfig reads and validates a manifest file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		var cfgErr *ConfigError
+		if errors.As(err, &cfgErr) {
+			cfgErr.File = path
+		}
+		return nil, err
+	}
+	return config, nil
+}
+
+// ParseConfig decodes a manifest strictly and validates it. Unknown keys,
+// malformed values and semantic problems are all collected into a single
+// ConfigError rather than failing on the first one.
+func ParseConfig(data []byte) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if len(root.Content) == 0 {
+		return nil, &ConfigError{Problems: []ConfigProblem{{Message: "config is empty"}}}
+	}
+
+	v := &configValidator{root: root.Content[0]}
+
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+		for _, msg := range typeErr.Errors {
+			v.addDecodeError(msg)
+		}
+	}
+
+	v.mergeServerConfig(&config)
+	v.validate(&config)
+
+	if len(v.problems) > 0 {
+		sort.SliceStable(v.problems, func(i, j int) bool {
+			return v.problems[i].Line < v.problems[j].Line
+		})
+		return nil, &ConfigError{Problems: v.problems}
+	}
+	return &config, nil
+}
+
+// ValidateModule checks a single module definition against the server
+// settings, as the manifest loader would
+func ValidateModule(config *Config, module Module) error {
+	v := &configValidator{}
+	v.validateModule(config, module, nil)
+	if len(v.problems) > 0 {
+		return &ConfigError{File: "module " + module.Name, Problems: v.problems}
+	}
+	return nil
+}
+
+// configValidator collects problems, resolving their YAML line numbers from
+// the parsed node tree
+type configValidator struct {
+	root     *yaml.Node
+	problems []ConfigProblem
+}
+
+var decodeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+func (v *configValidator) addDecodeError(msg string) {
+	if m := decodeErrorLine.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		v.problems = append(v.problems, ConfigProblem{Line: line, Message: m[2]})
+		return
+	}
+	v.problems = append(v.problems, ConfigProblem{Message: msg})
+}
+
+// addf records a problem at the given path. Path elements are mapping keys
+// (string) or sequence indices (int).
+func (v *configValidator) addf(path []any, format string, args ...any) {
+	v.problems = append(v.problems, ConfigProblem{
+		Line:    v.line(path),
+		Path:    formatPath(path),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// line returns the line of the deepest node found along path
+func (v *configValidator) line(path []any) int {
+	if v.root == nil {
+		return 0
+	}
+	node := v.root
+	line := node.Line
+	for _, elem := range path {
+		next := childNode(node, elem)
+		if next == nil {
+			break
+		}
+		node = next
+		line = node.Line
+	}
+	return line
+}
+
+func childNode(node *yaml.Node, elem any) *yaml.Node {
+	switch key := elem.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+			return node.Content[key]
+		}
+	}
+	return nil
+}
+
+func formatPath(path []any) string {
+	var b strings.Builder
+	for _, elem := range path {
+		switch e := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, e)
+		}
+	}
+	return b.String()
+}
+
+func at(path []any, elems ...any) []any {
+	out := make([]any, 0, len(path)+len(elems))
+	out = append(out, path...)
+	return append(out, elems...)
+}
+
+// mergeServerConfig moves the server_config block onto the flat fields.
+// Setting the same key in both places is reported rather than guessed.
+func (v *configValidator) mergeServerConfig(config *Config) {
+	sc := config.ServerConfig
+	if sc == nil {
+		return
+	}
+	conflict := func(key string) {
+		v.addf([]any{"server_config", key}, "%s is set both at the top level and in server_config", key)
+	}
+	if sc.Host != "" {
+		if config.Host != "" {
+			conflict("host")
+		}
+		config.Host = sc.Host
+	}
+	if sc.Port != 0 {
+		if config.Port != 0 {
+			conflict("port")
+		}
+		config.Port = sc.Port
+	}
+	if sc.MaxConnections != 0 {
+		if config.MaxConnections != 0 {
+			conflict("max_connections")
+		}
+		config.MaxConnections = sc.MaxConnections
+	}
+	if sc.Timeout != 0 {
+		if config.Timeout != 0 {
+			conflict("timeout")
+		}
+		config.Timeout = sc.Timeout
+	}
+	if len(sc.Transports) > 0 {
+		if len(config.Transports) > 0 {
+			conflict("transports")
+		}
+		config.Transports = sc.Transports
+	}
+	if len(sc.AllowedOrigins) > 0 {
+		if len(config.AllowedOrigins) > 0 {
+			conflict("allowed_origins")
+		}
+		config.AllowedOrigins = sc.AllowedOrigins
+	}
+}
+
+// serverKeyPath points at a server setting wherever it was declared
+func (v *configValidator) serverKeyPath(key string) []any {
+	if v.root != nil && childNode(v.root, "server_config") != nil {
+		return []any{"server_config", key}
+	}
+	return []any{key}
+}
+
+func (v *configValidator) validate(config *Config) {
+	if config.Port < 0 || config.Port > 65535 {
+		v.addf(v.serverKeyPath("port"), "port %d is out of range 1-65535", config.Port)
+	}
+	if config.MaxConnections < 0 {
+		v.addf(v.serverKeyPath("max_connections"), "must not be negative")
+	}
+	if config.Timeout < 0 {
+		v.addf(v.serverKeyPath("timeout"), "must not be negative")
+	}
+	seen := make(map[string]bool)
+	for i, transport := range config.Transports {
+		switch {
+		case !slices.Contains(knownTransports, transport):
+			v.addf(at(v.serverKeyPath("transports"), i), "unknown transport %q, expected one of %s", transport, strings.Join(knownTransports, ", "))
+		case seen[transport]:
+			v.addf(at(v.serverKeyPath("transports"), i), "duplicate transport %q", transport)
+		}
+		seen[transport] = true
+	}
+	for i, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			v.addf(at(v.serverKeyPath("allowed_origins"), i), "allowed origin %q must be * or scheme://host[:port]", origin)
+		}
+	}
+
+	v.validateIPFS(config.IPFS)
+	v.validateTracing(config.Tracing)
+	v.validateLogging(config.Logging)
+	v.validateAuth(config.Auth)
+	switch config.SignaturePolicy {
+	case "", SignaturePolicyEnforce, SignaturePolicyWarn, SignaturePolicyOff:
+	default:
+		v.addf([]any{"signature_policy"}, "unknown signature policy %q, expected %s, %s or %s",
+			config.SignaturePolicy, SignaturePolicyEnforce, SignaturePolicyWarn, SignaturePolicyOff)
+	}
+
+	moduleNames := make(map[string]int)
+	toolNames := make(map[string]string)
+	for i, module := range config.Modules {
+		path := []any{"modules", i}
+		v.validateModule(config, module, path)
+
+		if module.Name != "" {
+			if prev, ok := moduleNames[module.Name]; ok {
+				v.addf(at(path, "name"), "duplicate module name %q (also modules[%d])", module.Name, prev)
+			} else {
+				moduleNames[module.Name] = i
+			}
+		}
+		for j, tool := range module.Tools {
+			if tool.Name == "" {
+				continue
+			}
+			if owner, ok := toolNames[tool.Name]; ok {
+				v.addf(at(path, "tools", j, "name"), "duplicate tool name %q (also defined in module %q)", tool.Name, owner)
+			} else {
+				toolNames[tool.Name] = module.Name
+			}
+		}
+	}
+}
+
+func (v *configValidator) validateIPFS(cfg IPFSConfig) {
+	path := []any{"ipfs"}
+	if cfg.Enable {
+		switch cfg.LassieNet.Scheme {
+		case "http", "https":
+		default:
+			v.addf(at(path, "lassie_net", "scheme"), "scheme must be http or https, got %q", cfg.LassieNet.Scheme)
+		}
+		if cfg.LassieNet.Host == "" {
+			v.addf(at(path, "lassie_net", "host"), "host is required when IPFS is enabled")
+		}
+		if cfg.LassieNet.Port <= 0 || cfg.LassieNet.Port > 65535 {
+			v.addf(at(path, "lassie_net", "port"), "port %d is out of range 1-65535", cfg.LassieNet.Port)
+		}
+	}
+	for i, c := range cfg.CIDS {
+		if _, err := cid.Decode(c); err != nil {
+			v.addf(at(path, "cids", i), "invalid CID %q: %v", c, err)
+		}
+	}
+	if cfg.Cache.MaxBytes < 0 {
+		v.addf(at(path, "cache", "max_bytes"), "max_bytes must not be negative")
+	}
+	if cfg.MaxResponseBytes < 0 {
+		v.addf(at(path, "max_response_bytes"), "max_response_bytes must not be negative")
+	}
+	if cfg.Offline && cfg.Cache.Dir == "" {
+		v.addf(at(path, "offline"), "offline mode requires cache.dir")
+	}
+}
+
+func (v *configValidator) validateTracing(cfg TracingConfig) {
+	path := []any{"tracing"}
+	switch cfg.Exporter {
+	case "", ExporterOTLP:
+	case ExporterFile:
+		if cfg.File == "" {
+			v.addf(at(path, "file"), "file is required with the file exporter")
+		}
+	default:
+		v.addf(at(path, "exporter"), "unknown exporter %q, expected %s or %s", cfg.Exporter, ExporterOTLP, ExporterFile)
+	}
+	if r := cfg.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		v.addf(at(path, "sample_ratio"), "sample_ratio %v is out of range 0-1", *r)
+	}
+}
+
+func (v *configValidator) validateLogging(cfg LoggingConfig) {
+	path := []any{"logging"}
+	if _, err := ParseLogLevel(cfg.Level); err != nil {
+		v.addf(at(path, "level"), "%v", err)
+	}
+	switch cfg.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		v.addf(at(path, "format"), "unknown log format %q, expected %s or %s", cfg.Format, LogFormatText, LogFormatJSON)
+	}
+	for i, name := range cfg.Redact.Arguments {
+		if name == "" {
+			v.addf(at(path, "redact", "arguments", i), "argument name is empty")
+		}
+	}
+}
+
+func (v *configValidator) validateAuth(cfg AuthConfig) {
+	path := []any{"auth"}
+	hashes := make(map[string]int)
+	for i, key := range cfg.APIKeys {
+		keyPath := at(path, "api_keys", i)
+		if key.Principal == "" {
+			v.addf(at(keyPath, "principal"), "principal is required")
+		}
+		digest, ok := strings.CutPrefix(key.Hash, apiKeyHashPrefix)
+		if _, err := hex.DecodeString(digest); !ok || err != nil || len(digest) != 2*sha256.Size {
+			v.addf(at(keyPath, "hash"), "hash must be %q followed by %d hex digits", apiKeyHashPrefix, 2*sha256.Size)
+		} else if prev, dup := hashes[strings.ToLower(digest)]; dup {
+			v.addf(at(keyPath, "hash"), "duplicate API key (also api_keys[%d])", prev)
+		} else {
+			hashes[strings.ToLower(digest)] = i
+		}
+		for j, scope := range key.Scopes {
+			if scope == "" {
+				v.addf(at(keyPath, "scopes", j), "scope is empty")
+			}
+		}
+	}
+
+	jwt := cfg.JWT
+	if !jwt.enabled() && jwt != (JWTConfig{}) {
+		v.addf(at(path, "jwt"), "jwks_file or issuer is required")
+	}
+	if jwt.Issuer != "" && jwt.JWKSFile == "" {
+		// Without a JWKS file the keys are discovered from the issuer URL
+		if u, err := url.Parse(jwt.Issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			v.addf(at(path, "jwt", "issuer"), "issuer must be an http or https URL to discover its keys, or set jwks_file")
+		}
+	}
+	if jwt.Leeway < 0 {
+		v.addf(at(path, "jwt", "leeway"), "must not be negative")
+	}
+
+	wallet := cfg.Wallet
+	if wallet.Enable && wallet.Domain == "" {
+		// The request's Host is chosen by the client, so it cannot stand in
+		v.addf(at(path, "wallet", "domain"), "domain is required when wallet sign-in is enabled")
+	}
+	if wallet.URI != "" {
+		if u, err := url.Parse(wallet.URI); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			v.addf(at(path, "wallet", "uri"), "uri must be an http or https URL")
+		}
+	}
+	if wallet.ChainID < 0 {
+		v.addf(at(path, "wallet", "chain_id"), "must not be negative")
+	}
+	if wallet.NonceTTL < 0 {
+		v.addf(at(path, "wallet", "nonce_ttl"), "must not be negative")
+	}
+	if wallet.SessionTTL < 0 {
+		v.addf(at(path, "wallet", "session_ttl"), "must not be negative")
+	}
+	for i, address := range wallet.AllowedAddresses {
+		if !common.IsHexAddress(address) {
+			v.addf(at(path, "wallet", "allowed_addresses", i), "invalid Ethereum address %q", address)
+		}
+	}
+	for i, scope := range wallet.Scopes {
+		if scope == "" {
+			v.addf(at(path, "wallet", "scopes", i), "scope is empty")
+		}
+	}
+}
+
+func (v *configValidator) validateModule(config *Config, module Module, path []any) {
+	if module.Name == "" {
+		v.addf(at(path, "name"), "module name is required")
+	}
+
+	if module.WASMPath == "" {
+		v.addf(at(path, "wasm_path"), "wasm_path is required")
+	} else {
+		scheme, target := parseWASMPath(module.WASMPath)
+		switch scheme {
+		case schemeFile:
+			if target == "" {
+				v.addf(at(path, "wasm_path"), "file:// path is empty")
+			}
+		case schemeIPFS:
+			if !config.IPFS.Enable {
+				v.addf(at(path, "wasm_path"), "IPFS module requires ipfs.enable")
+			}
+			if _, err := cid.Decode(target); err != nil {
+				v.addf(at(path, "wasm_path"), "invalid CID %q: %v", target, err)
+			}
+		case "":
+		default:
+			v.addf(at(path, "wasm_path"), "unsupported scheme %q, expected file:// or IPFS://", scheme)
+		}
+	}
+
+	if module.Publisher != "" && !common.IsHexAddress(module.Publisher) {
+		v.addf(at(path, "publisher"), "invalid Ethereum address %q", module.Publisher)
+	}
+	if module.Publisher == "" && config.SignaturePolicy == SignaturePolicyEnforce {
+		v.addf(at(path, "publisher"), "publisher is required when signature_policy is %s", SignaturePolicyEnforce)
+	}
+	if module.Signature != "" {
+		if module.SignatureFile != "" {
+			v.addf(at(path, "signature"), "signature and signature_file are mutually exclusive")
+		}
+		if _, err := ParseModuleSignature([]byte(module.Signature)); err != nil {
+			v.addf(at(path, "signature"), "%v", err)
+		}
+	}
+	if (module.Signature != "" || module.SignatureFile != "") && module.Publisher == "" {
+		v.addf(at(path, "publisher"), "publisher is required to check the signature")
+	}
+
+	if module.Timeout < 0 {
+		v.addf(at(path, "timeout"), "must not be negative")
+	}
+	if module.IdleTimeout < 0 {
+		v.addf(at(path, "idle_timeout"), "must not be negative")
+	}
+	if module.QueueTimeout < 0 {
+		v.addf(at(path, "queue_timeout"), "must not be negative")
+	}
+	if module.MinInstances < 0 {
+		v.addf(at(path, "min_instances"), "must not be negative")
+	}
+	if module.MaxInstances < 0 {
+		v.addf(at(path, "max_instances"), "must not be negative")
+	}
+	if module.MaxInstances > 0 && module.MinInstances > module.MaxInstances {
+		v.addf(at(path, "min_instances"), "min_instances %d exceeds max_instances %d", module.MinInstances, module.MaxInstances)
+	}
+	if module.MaxHTTPResponseBytes < 0 {
+		v.addf(at(path, "max_http_response_bytes"), "must not be negative")
+	}
+	if module.MaxVarBytes < 0 {
+		v.addf(at(path, "max_var_bytes"), "must not be negative")
+	}
+
+	if len(module.Tools) == 0 {
+		v.addf(at(path, "tools"), "module declares no tools")
+	}
+	for j, tool := range module.Tools {
+		toolPath := at(path, "tools", j)
+		if tool.Name == "" {
+			v.addf(at(toolPath, "name"), "tool name is required")
+		}
+		if tool.Timeout < 0 {
+			v.addf(at(toolPath, "timeout"), "must not be negative")
+		}
+		if err := checkToolInputs(tool.Inputs, ""); err != nil {
+			v.addf(at(toolPath, "inputs"), "%v", err)
+		}
+		if err := checkToolOutput(tool.Outputs); err != nil {
+			v.addf(at(toolPath, "outputs"), "%v", err)
+		}
+		if _, err := newInputEncoder(tool); err != nil {
+			v.addf(at(toolPath, "input_mode"), "%v", err)
+		}
+		for k, id := range tool.AllowedPrincipals {
+			if err := checkPrincipalID(id); err != nil {
+				v.addf(at(toolPath, "allowed_principals", k), "%v", err)
+			}
+		}
+		for k, scope := range tool.Scopes {
+			if scope == "" {
+				v.addf(at(toolPath, "scopes", k), "scope is empty")
+			}
+		}
+	}
+}
+
+// checkPrincipalID checks an allowed_principals entry, which names a
+// caller by method and name. Wallet addresses must be checksummed, since
+// entries are matched exactly.
+func checkPrincipalID(id string) error {
+	method, name, ok := strings.Cut(id, ":")
+	if !ok || method == "" || name == "" {
+		return fmt.Errorf("principal %q must be method:name, as in %s:ci-bot, %s:<sub> or %s:0x...", id, AuthMethodAPIKey, AuthMethodJWT, AuthMethodWallet)
+	}
+	if method == AuthMethodWallet {
+		if !common.IsHexAddress(name) {
+			return fmt.Errorf("principal %q is not a wallet address", id)
+		}
+		if checksummed := common.HexToAddress(name).Hex(); name != checksummed {
+			return fmt.Errorf("principal %q must use the checksummed address %s:%s", id, AuthMethodWallet, checksummed)
+		}
+	}
+	return nil
+}
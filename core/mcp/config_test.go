@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []ConfigProblem // Message is matched as a substring
+	}{
+		{
+			name:     "unknown key",
+			manifest: "host: 127.0.0.1\nbogus: 1\n",
+			want:     []ConfigProblem{{Line: 2, Message: "field bogus not found"}},
+		},
+		{
+			name:     "unknown nested key",
+			manifest: "ipfs:\n  enable: false\n  lassie:\n    host: x\n",
+			want:     []ConfigProblem{{Line: 3, Message: "field lassie not found"}},
+		},
+		{
+			name:     "int for a duration",
+			manifest: "server_config:\n  timeout: 30\n",
+			want:     []ConfigProblem{{Line: 2, Message: "into time.Duration"}},
+		},
+		{
+			name:     "string for an int",
+			manifest: "port: eighty\n",
+			want:     []ConfigProblem{{Line: 1, Message: "into int"}},
+		},
+		{
+			name:     "server_config and flat key conflict",
+			manifest: "port: 1\nserver_config:\n  port: 2\n",
+			want:     []ConfigProblem{{Line: 3, Path: "server_config.port", Message: "set both at the top level and in server_config"}},
+		},
+		{
+			name:     "port out of range in server_config",
+			manifest: "server_config:\n  port: 70000\n",
+			want:     []ConfigProblem{{Line: 2, Path: "server_config.port", Message: "out of range"}},
+		},
+		{
+			name:     "every problem reported",
+			manifest: "bogus: 1\nsignature_policy: maybe\nserver_config:\n  transports: [carrier_pigeon]\n",
+			want: []ConfigProblem{
+				{Line: 1, Message: "field bogus not found"},
+				{Line: 2, Path: "signature_policy", Message: "unknown signature policy"},
+				{Line: 4, Path: "server_config.transports[0]", Message: "unknown transport"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.manifest))
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("error %v, want a ConfigError", err)
+			}
+			if len(cfgErr.Problems) != len(tt.want) {
+				t.Fatalf("problems:\n%v\nwant %d", cfgErr, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := cfgErr.Problems[i]
+				if got.Line != want.Line || got.Path != want.Path || !strings.Contains(got.Message, want.Message) {
+					t.Errorf("problem %d is %q, want line %d, path %q, message containing %q", i, got, want.Line, want.Path, want.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfigLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{
+			name: "flat",
+			manifest: `host: "127.0.0.1"
+port: 18080
+max_connections: 10
+timeout: 5s
+transports: ["streamable_http", "sse"]
+`,
+		},
+		{
+			name: "server_config",
+			manifest: `server_config:
+  host: "127.0.0.1"
+  port: 18080
+  max_connections: 10
+  timeout: 5s
+  transports: ["streamable_http", "sse"]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Host != "127.0.0.1" || config.Port != 18080 || config.MaxConnections != 10 || config.Timeout != 5*time.Second {
+				t.Errorf("server settings %s:%d, %d connections, %v timeout", config.Host, config.Port, config.MaxConnections, config.Timeout)
+			}
+			if strings.Join(config.Transports, ",") != "streamable_http,sse" {
+				t.Errorf("transports %v", config.Transports)
+			}
+		})
+	}
+}
+
+func TestBundledManifestLoads(t *testing.T) {
+	if _, err := LoadConfig("../../config/mcp_manifest.yaml"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigNamesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(path, []byte("bogus: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": 1 problem(s) found") {
+		t.Errorf("error %v, want one naming %s", err, path)
+	}
+}
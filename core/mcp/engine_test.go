@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Modules bundled in wasm-examples. say_hello answers "Hello, <input>!",
+// which makes the bytes a tool's input mode produced visible.
+const (
+	sayHelloWASM = "file://../../wasm-examples/say_hello/say_hello.wasm"
+	validateWASM = "file://../../wasm-examples/data-validation/validate.wasm"
+)
+
+// newTestEngine loads modules into an engine that is closed when the test ends
+func newTestEngine(t *testing.T, modules ...Module) *WASMEngine {
+	t.Helper()
+	w := NewWASMEngine(&Config{SignaturePolicy: SignaturePolicyOff})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		w.Close(ctx)
+	})
+	for _, module := range modules {
+		if err := w.LoadModule(context.Background(), module); err != nil {
+			t.Fatalf("LoadModule(%s): %v", module.Name, err)
+		}
+	}
+	return w
+}
+
+// sayHelloModule serves say_hello through tool
+func sayHelloModule(tool Tool) Module {
+	tool.Name = "say_hello"
+	return Module{Name: "hello", WASMPath: sayHelloWASM, Tools: []Tool{tool}}
+}
+
+// resultText returns the text of a result holding one text content
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if len(result.Content) != 1 {
+		t.Fatalf("result has %d contents, want 1", len(result.Content))
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("result content is %T, want text", result.Content[0])
+	}
+	return text.Text
+}
@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Tool error codes reported in the structured content of failed tool calls
+const (
+	ErrCodeInvalidArguments  = "invalid_arguments"
+	ErrCodeInvalidOutput     = "invalid_output"
+	ErrCodeTimeout           = "timeout"
+	ErrCodeCancelled         = "cancelled"
+	ErrCodeResourceExhausted = "resource_exhausted"
+	ErrCodeBusy              = "busy"
+	ErrCodeNotFound          = "not_found"
+	ErrCodeForbidden         = "forbidden"
+	ErrCodeInternal          = "internal_error"
+)
+
+// ToolError is the structured payload returned to clients when a tool call fails
+type ToolError struct {
+	Code       string            `json:"code"`
+	Message    string            `json:"message"`
+	Violations []SchemaViolation `json:"violations,omitempty"`
+}
+
+// Error implements the error interface
+func (e *ToolError) Error() string {
+	if len(e.Violations) == 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.String())
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, strings.Join(parts, "; "))
+}
+
+// Result converts the error into an MCP tool result flagged with isError.
+// The text content carries a human-readable summary, the structured content
+// carries the error object so clients can branch on the code.
+func (e *ToolError) Result() *mcp.CallToolResult {
+	payload, err := json.Marshal(map[string]any{"error": e})
+	if err != nil {
+		return mcp.NewToolResultError(e.Error())
+	}
+
+	var structured map[string]any
+	if err := json.Unmarshal(payload, &structured); err != nil {
+		return mcp.NewToolResultError(e.Error())
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: e.Error(),
+			},
+		},
+		StructuredContent: structured,
+		IsError:           true,
+	}
+}
+
+// guestError is a call the module failed itself, by returning a non-zero
+// exit code or setting an error, rather than the host failing to run it
+type guestError struct {
+	exitCode uint32
+	output   []byte
+	message  string
+}
+
+// Error implements the error interface
+func (e *guestError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("module returned exit code %d: %s", e.exitCode, e.message)
+	}
+	return fmt.Sprintf("module returned exit code %d", e.exitCode)
+}
+
+// result maps what the guest wrote before failing onto a tool result
+// flagged with isError, falling back to the error text when the output
+// does not fit the tool's declared output
+func (e *guestError) result(tool Tool) *mcp.CallToolResult {
+	if len(e.output) > 0 {
+		if result, err := buildResult(tool, e.output); err == nil {
+			result.IsError = true
+			return result
+		}
+	}
+	return mcp.NewToolResultError(e.Error())
+}
+
+// newToolError creates a ToolError with the given code and message
+func newToolError(code, format string, args ...any) *ToolError {
+	return &ToolError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
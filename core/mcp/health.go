@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DANP-LABS/DANP-Engine/pkg/ipfs"
+)
+
+// ipfsProbeTimeout bounds the gateway check of a readiness probe
+const ipfsProbeTimeout = 2 * time.Second
+
+// ipfsProbeTTL is how long the outcome of a gateway check is reused
+const ipfsProbeTTL = 10 * time.Second
+
+// Health statuses reported by /healthz and /readyz
+const (
+	HealthOK       = "ok"
+	HealthReady    = "ready"
+	HealthNotReady = "not_ready"
+)
+
+// HealthReport is the body of /healthz and /readyz. Problems lists why the
+// server is not ready; it is empty when it is.
+type HealthReport struct {
+	Status   string       `json:"status"`
+	Modules  []ModuleInfo `json:"modules"`
+	IPFS     *IPFSHealth  `json:"ipfs,omitempty"`
+	Problems []string     `json:"problems,omitempty"`
+}
+
+// HealthSummary is the body of /healthz and /readyz for callers that do
+// not authenticate: the status and the names of the modules, but not their
+// sources or errors
+type HealthSummary struct {
+	Status  string   `json:"status"`
+	Modules []string `json:"modules"`
+}
+
+// IPFSHealth reports whether the IPFS gateway answered the readiness probe.
+// Offline nodes do not use the gateway, so it is not probed.
+type IPFSHealth struct {
+	Gateway   string `json:"gateway"`
+	Reachable bool   `json:"reachable"`
+	Offline   bool   `json:"offline,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ipfsProbe remembers the last gateway check, so that frequent probes
+// neither create a client nor reach the gateway each time
+type ipfsProbe struct {
+	mu      sync.Mutex
+	gateway string
+	client  *ipfs.Client
+	checked time.Time
+	err     error
+}
+
+// ping checks the gateway, or returns the outcome of a check made less
+// than ipfsProbeTTL ago
+func (p *ipfsProbe) ping(ctx context.Context, lassie LassieNet) error {
+	gateway := fmt.Sprintf("%s://%s:%d", lassie.Scheme, lassie.Host, lassie.Port)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gateway == gateway && time.Since(p.checked) < ipfsProbeTTL {
+		return p.err
+	}
+	if p.gateway != gateway || p.client == nil {
+		p.client = ipfs.NewClient(lassie.Scheme, lassie.Host, lassie.Port, ipfsProbeTimeout)
+		p.gateway = gateway
+		p.checked = time.Time{}
+	}
+	err := p.client.Ping(ctx)
+	// A probe that gave up says nothing about the gateway
+	if ctx.Err() == nil {
+		p.checked, p.err = time.Now(), err
+	}
+	return err
+}
+
+// registerHealthRoutes mounts the probes on mux. They answer without
+// credentials so that orchestrators can reach them, but only callers that
+// authenticate see module details.
+func (s *MCPServer) registerHealthRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /healthz", s.optionalAuth(http.HandlerFunc(s.handleHealthz)))
+	mux.Handle("GET /readyz", s.optionalAuth(http.HandlerFunc(s.handleReadyz)))
+}
+
+// handleHealthz answers as long as the process serves HTTP
+func (s *MCPServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, http.StatusOK, HealthReport{Status: HealthOK, Modules: s.ListModules()})
+}
+
+// handleReadyz answers 503 until every required module is loaded and, with
+// IPFS enabled, the gateway is reachable
+func (s *MCPServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := s.Readiness(r.Context())
+	status := http.StatusOK
+	if report.Status != HealthReady {
+		status = http.StatusServiceUnavailable
+		slog.DebugContext(r.Context(), "Readiness probe failed", "problems", report.Problems)
+	}
+	s.writeHealth(w, r, status, report)
+}
+
+// Readiness checks whether the server should receive traffic
+func (s *MCPServer) Readiness(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthReady, Modules: s.ListModules()}
+	if s.stopCtx.Err() != nil {
+		report.Problems = append(report.Problems, "server is shutting down")
+	}
+
+	config := s.currentConfig()
+	loaded := make(map[string]ModuleInfo, len(report.Modules))
+	for _, info := range report.Modules {
+		loaded[info.Name] = info
+	}
+	// Required comes from the module definitions, so a required module
+	// that never made it into the module list still counts
+	for _, module := range s.requiredModules(config) {
+		info, ok := loaded[module]
+		switch {
+		case !ok:
+			report.Problems = append(report.Problems, fmt.Sprintf("required module %s is not loaded", module))
+		case info.Status != ModuleLoaded:
+			report.Problems = append(report.Problems, fmt.Sprintf("required module %s is %s: %s", module, info.Status, info.LastError))
+		}
+	}
+
+	if config.IPFS.Enable && config.IPFS.Offline {
+		lassie := config.IPFS.LassieNet
+		report.IPFS = &IPFSHealth{Gateway: fmt.Sprintf("%s://%s:%d", lassie.Scheme, lassie.Host, lassie.Port), Offline: true}
+	} else if config.IPFS.Enable {
+		lassie := config.IPFS.LassieNet
+		report.IPFS = &IPFSHealth{Gateway: fmt.Sprintf("%s://%s:%d", lassie.Scheme, lassie.Host, lassie.Port), Reachable: true}
+		if err := s.ipfsProbe.ping(ctx, lassie); err != nil {
+			report.IPFS.Reachable = false
+			report.IPFS.Error = err.Error()
+			report.Problems = append(report.Problems, "IPFS gateway is unreachable")
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		report.Status = HealthNotReady
+	}
+	return report
+}
+
+// requiredModules lists the required modules of the manifest and of the
+// modules loaded through the admin API
+func (s *MCPServer) requiredModules(config *Config) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, module := range config.Modules {
+		if module.Required && !seen[module.Name] {
+			seen[module.Name] = true
+			names = append(names, module.Name)
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name, state := range s.modules {
+		if state.module.Required && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// writeHealth sends report to authenticated callers, and its summary to
+// the others when authentication is configured
+func (s *MCPServer) writeHealth(w http.ResponseWriter, r *http.Request, status int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if _, ok := PrincipalFromContext(r.Context()); ok || len(s.authenticators()) == 0 {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	summary := HealthSummary{Status: report.Status, Modules: make([]string, 0, len(report.Modules))}
+	for _, info := range report.Modules {
+		summary.Modules = append(summary.Modules, info.Name)
+	}
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,80 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthDetailsNeedCredentials(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Modules:         []Module{sayHelloModule(Tool{})},
+		Auth:            AuthConfig{APIKeys: []APIKeyConfig{{Principal: "ops", Hash: HashAPIKey(key)}}},
+	})
+	mux := http.NewServeMux()
+	s.registerHealthRoutes(mux)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		probe := func(key string) map[string]any {
+			t.Helper()
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			if key != "" {
+				r.Header.Set("X-API-Key", key)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: %d %s", path, w.Code, w.Body)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}
+
+		anonymous := probe("")
+		if modules, _ := anonymous["modules"].([]any); len(modules) != 1 || modules[0] != "hello" {
+			t.Errorf("GET %s without credentials: modules %v, want [hello]", path, anonymous["modules"])
+		}
+		authenticated := probe(key)
+		modules, _ := authenticated["modules"].([]any)
+		if len(modules) != 1 {
+			t.Fatalf("GET %s with credentials: modules %v", path, authenticated["modules"])
+		}
+		if info, _ := modules[0].(map[string]any); info["source"] != sayHelloWASM {
+			t.Errorf("GET %s with credentials: module %v, want its details", path, modules[0])
+		}
+	}
+}
+
+func TestIPFSProbeIsCached(t *testing.T) {
+	var pings atomic.Int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+	}))
+	defer gateway.Close()
+	host, port, _ := net.SplitHostPort(gateway.Listener.Addr().String())
+	lassie := LassieNet{Scheme: "http", Host: host}
+	lassie.Port, _ = strconv.Atoi(port)
+
+	var probe ipfsProbe
+	for range 3 {
+		if err := probe.ping(context.Background(), lassie); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+	}
+	if n := pings.Load(); n != 1 {
+		t.Errorf("gateway pinged %d times, want 1", n)
+	}
+}
@@ -0,0 +1,249 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"text/template"
+)
+
+// Supported tool input modes, controlling how call arguments are encoded
+// before they are handed to the WASM export
+const (
+	InputArgumentsJSON = "arguments_json"
+	InputSingleArgRaw  = "single_arg_raw"
+	InputTemplate      = "template"
+	InputMsgpack       = "msgpack"
+)
+
+// inputEncoder turns validated call arguments into the bytes passed to the guest
+type inputEncoder func(args map[string]any) ([]byte, error)
+
+// newInputEncoder builds the encoder for a tool's input_mode
+func newInputEncoder(tool Tool) (inputEncoder, error) {
+	switch tool.InputMode {
+	case "", InputArgumentsJSON:
+		return encodeArgumentsJSON, nil
+	case InputSingleArgRaw:
+		name := tool.InputArg
+		if name == "" {
+			if len(tool.Inputs) != 1 {
+				return nil, fmt.Errorf("input_mode %s requires input_arg when the tool has %d inputs", InputSingleArgRaw, len(tool.Inputs))
+			}
+			name = tool.Inputs[0].Name
+		} else if !slices.ContainsFunc(tool.Inputs, func(input ToolInput) bool { return input.Name == name }) {
+			return nil, fmt.Errorf("input_arg %q is not one of the tool's inputs", name)
+		}
+		return func(args map[string]any) ([]byte, error) {
+			return encodeSingleArg(args, name)
+		}, nil
+	case InputTemplate:
+		if tool.InputTemplate == "" {
+			return nil, fmt.Errorf("input_mode %s requires input_template", InputTemplate)
+		}
+		// Declared inputs are always present, so a missing key is a typo
+		tmpl, err := template.New(tool.Name).
+			Option("missingkey=error").
+			Funcs(template.FuncMap{"json": templateJSON}).
+			Parse(tool.InputTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input_template: %w", err)
+		}
+		return func(args map[string]any) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, templateData(tool.Inputs, args)); err != nil {
+				return nil, fmt.Errorf("failed to render input template: %w", err)
+			}
+			return buf.Bytes(), nil
+		}, nil
+	case InputMsgpack:
+		return encodeMsgpack, nil
+	default:
+		return nil, fmt.Errorf("unsupported input_mode %q", tool.InputMode)
+	}
+}
+
+func encodeArgumentsJSON(args map[string]any) ([]byte, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	return json.Marshal(args)
+}
+
+// encodeSingleArg passes strings through verbatim and JSON-encodes anything else
+func encodeSingleArg(args map[string]any, name string) ([]byte, error) {
+	value, ok := args[name]
+	if !ok {
+		return nil, fmt.Errorf("argument %q is required by input_mode %s", name, InputSingleArgRaw)
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+// templateData copies the arguments with every declared input that was
+// not passed set to the zero value of its type, so that optional inputs
+// render as empty rather than as "<no value>"
+func templateData(inputs []ToolInput, args map[string]any) map[string]any {
+	data := make(map[string]any, len(inputs))
+	for k, v := range args {
+		data[k] = v
+	}
+	for _, input := range inputs {
+		value, ok := data[input.Name]
+		if !ok {
+			data[input.Name] = zeroValue(input)
+			continue
+		}
+		if object, isObject := value.(map[string]any); isObject && input.Type == TypeObject {
+			data[input.Name] = templateData(input.Properties, object)
+		}
+	}
+	return data
+}
+
+// zeroValue is the value a template sees for an input that was not passed
+func zeroValue(input ToolInput) any {
+	switch input.Type {
+	case TypeNumber, TypeInteger:
+		return 0
+	case TypeBoolean:
+		return false
+	case TypeObject:
+		return templateData(input.Properties, nil)
+	case TypeArray:
+		return []any{}
+	default:
+		return ""
+	}
+}
+
+func templateJSON(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeMsgpack encodes the arguments as a MessagePack map
+func encodeMsgpack(args map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	if args == nil {
+		args = map[string]any{}
+	}
+	if err := writeMsgpack(&buf, args); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMsgpack(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case string:
+		writeMsgpackHeader(buf, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []byte:
+		writeMsgpackHeader(buf, len(v), 0, -1, 0xc4, 0xc5, 0xc6)
+		buf.Write(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			writeMsgpackInt(buf, int64(v))
+		} else {
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+		}
+	case int:
+		writeMsgpackInt(buf, int64(v))
+	case int64:
+		writeMsgpackInt(buf, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		return writeMsgpack(buf, f)
+	case []any:
+		writeMsgpackHeader(buf, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeMsgpackHeader(buf, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			if err := writeMsgpack(buf, k); err != nil {
+				return err
+			}
+			if err := writeMsgpack(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as msgpack", value)
+	}
+	return nil
+}
+
+// writeMsgpackHeader writes a length-prefixed header, using the fix format
+// when n fits in fixMax and the 8, 16 or 32 bit formats otherwise. A zero
+// code means the format does not exist for this family.
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, c8, c16, c32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fix | byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(c8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(c16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(c32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0 && v <= 127:
+		buf.WriteByte(byte(v))
+	case v < 0 && v >= -32:
+		buf.WriteByte(byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(v)))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(v))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, v)
+	}
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInputModes(t *testing.T) {
+	name := ToolInput{Name: "name", Type: TypeString, Required: true}
+	title := ToolInput{Name: "title", Type: TypeString}
+	count := ToolInput{Name: "count", Type: TypeInteger}
+
+	tests := []struct {
+		name string
+		tool Tool
+		args map[string]any
+		want string
+	}{
+		{
+			name: "arguments_json",
+			tool: Tool{Inputs: []ToolInput{name}},
+			args: map[string]any{"name": "Bob"},
+			want: `Hello, {"name":"Bob"}!`,
+		},
+		{
+			name: "single_arg_raw string",
+			tool: Tool{Inputs: []ToolInput{name, title}, InputMode: InputSingleArgRaw, InputArg: "name"},
+			args: map[string]any{"name": "Bob", "title": "Dr"},
+			want: "Hello, Bob!",
+		},
+		{
+			name: "single_arg_raw sole input",
+			tool: Tool{Inputs: []ToolInput{count}, InputMode: InputSingleArgRaw},
+			args: map[string]any{"count": 3},
+			want: "Hello, 3!",
+		},
+		{
+			name: "template",
+			tool: Tool{Inputs: []ToolInput{name, title}, InputMode: InputTemplate,
+				InputTemplate: `{{.title}} {{.name}}`},
+			args: map[string]any{"name": "Bob", "title": "Dr"},
+			want: "Hello, Dr Bob!",
+		},
+		{
+			name: "template optional input absent",
+			tool: Tool{Inputs: []ToolInput{name, title, count}, InputMode: InputTemplate,
+				InputTemplate: `{{.name}}{{if .title}} ({{.title}}){{end}} {{.count}} {{json .title}}`},
+			args: map[string]any{"name": "Bob"},
+			want: `Hello, Bob 0 ""!`,
+		},
+		{
+			name: "msgpack",
+			tool: Tool{Inputs: []ToolInput{name}, InputMode: InputMsgpack},
+			args: map[string]any{"name": "Bob"},
+			want: "Hello, \x81\xa4name\xa3Bob!",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestEngine(t, sayHelloModule(tt.tool))
+			result, err := w.CallTool(context.Background(), "hello", "say_hello", tt.args)
+			if err != nil {
+				t.Fatalf("CallTool: %v", err)
+			}
+			if got := resultText(t, result); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputModeRawJSON(t *testing.T) {
+	w := newTestEngine(t, Module{
+		Name:     "data_validation",
+		WASMPath: validateWASM,
+		Tools: []Tool{{
+			Name:      "validate_data",
+			Inputs:    []ToolInput{{Name: "json_data", Type: TypeString, Required: true}},
+			InputMode: InputSingleArgRaw,
+			InputArg:  "json_data",
+			Outputs:   ToolOutput{Type: OutputJSON},
+		}},
+	})
+
+	result, err := w.CallTool(context.Background(), "data_validation", "validate_data",
+		map[string]any{"json_data": `{"signature": "0x01"}`})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if result.IsError || result.StructuredContent.(map[string]any)["valid"] != true {
+		t.Errorf("valid data: isError %v, structured content %v", result.IsError, result.StructuredContent)
+	}
+
+	// The module exits with 1 but its output is still the tool's result
+	result, err = w.CallTool(context.Background(), "data_validation", "validate_data",
+		map[string]any{"json_data": `{}`})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError || result.StructuredContent.(map[string]any)["valid"] != false {
+		t.Errorf("invalid data: isError %v, structured content %v", result.IsError, result.StructuredContent)
+	}
+}
+
+func TestInputArgMustBeDeclared(t *testing.T) {
+	tool := Tool{
+		Name:      "say_hello",
+		Inputs:    []ToolInput{{Name: "name", Type: TypeString}},
+		InputMode: InputSingleArgRaw,
+		InputArg:  "nmae",
+	}
+	if _, err := newInputEncoder(tool); err == nil || !strings.Contains(err.Error(), "nmae") {
+		t.Errorf("newInputEncoder accepted undeclared input_arg, error %v", err)
+	}
+}
+
+func TestTemplateUndeclaredKey(t *testing.T) {
+	encode, err := newInputEncoder(Tool{
+		Name:          "say_hello",
+		Inputs:        []ToolInput{{Name: "name", Type: TypeString}},
+		InputMode:     InputTemplate,
+		InputTemplate: `{{.nmae}}`,
+	})
+	if err != nil {
+		t.Fatalf("newInputEncoder: %v", err)
+	}
+	if out, err := encode(map[string]any{"name": "Bob"}); err == nil {
+		t.Errorf("template with an undeclared key rendered %q", out)
+	}
+}
+
+func TestTemplateDataDoesNotModifyArguments(t *testing.T) {
+	inputs := []ToolInput{
+		{Name: "name", Type: TypeString},
+		{Name: "opts", Type: TypeObject, Properties: []ToolInput{{Name: "loud", Type: TypeBoolean}}},
+	}
+	opts := map[string]any{}
+	args := map[string]any{"opts": opts}
+	data := templateData(inputs, args)
+	if data["name"] != "" || data["opts"].(map[string]any)["loud"] != false {
+		t.Errorf("templateData = %v, want zero values for absent inputs", data)
+	}
+	if len(args) != 1 || len(opts) != 0 {
+		t.Errorf("templateData modified the arguments: %v", args)
+	}
+}
@@ -0,0 +1,396 @@
+package mcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// JWTConfig validates bearer JWTs. The signing keys are read from
+// JWKSFile, or else fetched from the JWKS the Issuer publishes through
+// OpenID discovery. Tokens must carry an expiry, come from Issuer when it
+// is set and name Audience when it is set. The principal is taken from
+// PrincipalClaim (default sub) and the scopes from ScopesClaim (default
+// scope), a space-separated string or a list.
+type JWTConfig struct {
+	JWKSFile       string        `yaml:"jwks_file"`
+	Issuer         string        `yaml:"issuer"`
+	Audience       string        `yaml:"audience"`
+	PrincipalClaim string        `yaml:"principal_claim"`
+	ScopesClaim    string        `yaml:"scopes_claim"`
+	Leeway         time.Duration `yaml:"leeway"`
+}
+
+// enabled reports whether JWT authentication is configured
+func (c JWTConfig) enabled() bool {
+	return c.JWKSFile != "" || c.Issuer != ""
+}
+
+const (
+	// jwksRefreshInterval is how long keys fetched from an issuer are used
+	// before they are fetched again
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefresh rate-limits the refetch triggered by an unknown key ID
+	jwksMinRefresh = time.Minute
+	// jwksFetchTimeout bounds a discovery or JWKS request
+	jwksFetchTimeout = 10 * time.Second
+	// maxJWKSBytes bounds the size of a fetched document
+	maxJWKSBytes = 1 << 20
+)
+
+// jwtAlgorithms are the signing methods a token may use; HMAC is left out
+// because a JWKS only carries public keys
+var jwtAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// jwtAuthenticator accepts bearer JWTs signed by a key of its key set
+type jwtAuthenticator struct {
+	config JWTConfig
+	parser *jwt.Parser
+	keys   *jwksCache
+}
+
+func newJWTAuthenticator(cfg JWTConfig) *jwtAuthenticator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.PrincipalClaim == "" {
+		cfg.PrincipalClaim = "sub"
+	}
+	if cfg.ScopesClaim == "" {
+		cfg.ScopesClaim = "scope"
+	}
+	return &jwtAuthenticator{
+		config: cfg,
+		parser: jwt.NewParser(opts...),
+		keys:   &jwksCache{file: cfg.JWKSFile, issuer: cfg.Issuer},
+	}
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || !looksLikeJWT(token) {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.lookup(r.Context(), kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT: %w", err)
+	}
+
+	name, _ := claims[a.config.PrincipalClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("invalid JWT: claim %s is missing", a.config.PrincipalClaim)
+	}
+	return &Principal{
+		Name:   name,
+		Method: AuthMethodJWT,
+		Scopes: scopesClaim(claims[a.config.ScopesClaim]),
+		Claims: claims,
+	}, nil
+}
+
+// scopesClaim reads a space-separated scope string or a list of scopes
+func scopesClaim(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var scopes []string
+		for _, item := range v {
+			if scope, ok := item.(string); ok && scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// jwksCache holds the verification keys of a JWKS file or issuer. A file
+// is read again when it changes on disk; an issuer's keys are fetched
+// again after jwksRefreshInterval, or sooner when a token names a key ID
+// the cache does not know, so that key rotation needs no restart. Loads
+// run outside mu, and concurrent requests share one load.
+type jwksCache struct {
+	file   string
+	issuer string
+	loads  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	all       []jwt.VerificationKey
+	fetchedAt time.Time
+	modTime   time.Time
+	err       error
+}
+
+// lookup returns the key named kid, or every key when the token names none
+func (c *jwksCache) lookup(ctx context.Context, kid string) (any, error) {
+	c.mu.Lock()
+	stale := c.stale(kid)
+	c.mu.Unlock()
+	if stale {
+		c.loads.Do("refresh", func() (any, error) {
+			c.refresh(ctx, kid)
+			return nil, nil
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil && c.all == nil {
+		return nil, fmt.Errorf("no verification keys: %w", c.err)
+	}
+	if kid == "" {
+		return jwt.VerificationKeySet{Keys: c.all}, nil
+	}
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// stale reports whether the keys must be loaded again. Callers hold mu.
+func (c *jwksCache) stale(kid string) bool {
+	if c.fetchedAt.IsZero() {
+		return true
+	}
+	if c.file != "" {
+		info, err := os.Stat(c.file)
+		return err != nil || !info.ModTime().Equal(c.modTime)
+	}
+	if time.Since(c.fetchedAt) > jwksRefreshInterval {
+		return true
+	}
+	_, known := c.keys[kid]
+	return kid != "" && !known && time.Since(c.fetchedAt) > jwksMinRefresh
+}
+
+// refresh loads the key set unless a load that finished meanwhile made
+// it current, keeping the previous keys if loading fails. Callers do not
+// hold mu.
+func (c *jwksCache) refresh(ctx context.Context, kid string) {
+	c.mu.Lock()
+	stale := c.stale(kid)
+	c.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	var data []byte
+	var modTime time.Time
+	var err error
+	if c.file != "" {
+		var info os.FileInfo
+		if info, err = os.Stat(c.file); err == nil {
+			modTime = info.ModTime()
+			data, err = os.ReadFile(c.file)
+		}
+	} else {
+		data, err = c.fetchIssuerJWKS(ctx)
+	}
+	var keys map[string]crypto.PublicKey
+	var all []jwt.VerificationKey
+	if err == nil {
+		keys, all, err = parseJWKS(data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetchedAt, c.modTime = time.Now(), modTime
+	if err != nil {
+		c.err = err
+		slog.ErrorContext(ctx, "Failed to load JWT verification keys", "source", c.source(), "error", err)
+		return
+	}
+	c.keys, c.all, c.err = keys, all, nil
+	slog.InfoContext(ctx, "Loaded JWT verification keys", "keys", len(all), "source", c.source())
+}
+
+func (c *jwksCache) source() string {
+	if c.file != "" {
+		return c.file
+	}
+	return c.issuer
+}
+
+// fetchIssuerJWKS finds the issuer's JWKS through OpenID discovery
+func (c *jwksCache) fetchIssuerJWKS(ctx context.Context) ([]byte, error) {
+	discovery, err := c.get(ctx, strings.TrimSuffix(c.issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("OpenID discovery failed: %w", err)
+	}
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(discovery, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenID configuration: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return nil, errors.New("OpenID configuration has no jwks_uri")
+	}
+	return c.get(ctx, doc.JWKSURI)
+}
+
+func (c *jwksCache) get(ctx context.Context, url string) ([]byte, error) {
+	// The request is not tied to the caller's context: a client that
+	// hangs up should not leave the cache without keys
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+}
+
+// jsonWebKey holds the members of a JWK that signature keys use
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the signature keys of a JWK set. Keys of other uses or
+// unsupported types are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, []jwt.VerificationKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	var all []jwt.VerificationKey
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("Skipping JWKS key", "index", i, "kid", jwk.Kid, "error", err)
+			continue
+		}
+		if jwk.Kid != "" {
+			keys[jwk.Kid] = key
+		}
+		all = append(all, key)
+	}
+	if len(all) == 0 {
+		return nil, nil, errors.New("JWKS holds no usable signature keys")
+	}
+	return keys, all, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid e")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key of %d bits is too short", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,240 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// Resources whose budgets can be exhausted by a module
+const (
+	ResourceMemory       = "memory"
+	ResourceFuel         = "fuel"
+	ResourceVars         = "vars"
+	ResourceHTTPResponse = "http_response"
+)
+
+// wasmPageSize is the size of a WebAssembly memory page in bytes
+const wasmPageSize = 65536
+
+var errFuelExhausted = errors.New("fuel budget exhausted")
+
+// ResourceKey identifies a resource budget of a module
+type ResourceKey struct {
+	Module   string
+	Resource string
+}
+
+// EngineStats counts budget violations per module and resource
+type EngineStats struct {
+	mu        sync.Mutex
+	exhausted map[ResourceKey]uint64
+}
+
+// NewEngineStats creates an empty stats collector
+func NewEngineStats() *EngineStats {
+	return &EngineStats{exhausted: make(map[ResourceKey]uint64)}
+}
+
+func (s *EngineStats) recordExhausted(module, resource string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exhausted[ResourceKey{Module: module, Resource: resource}]++
+}
+
+// ResourceExhausted returns a snapshot of the budget violation counters
+func (s *EngineStats) ResourceExhausted() map[ResourceKey]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[ResourceKey]uint64, len(s.exhausted))
+	for k, v := range s.exhausted {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// manifestMemory converts the module budgets into extism memory settings.
+// Extism treats a zero HTTP or var limit as "disabled", so unset limits are
+// passed as -1 to keep the extism defaults. max_memory_pages is enforced by
+// memoryBudget instead, so that running into it can be told apart from
+// other failures.
+func manifestMemory(module Module) *extism.ManifestMemory {
+	memory := &extism.ManifestMemory{
+		MaxHttpResponseBytes: -1,
+		MaxVarBytes:          -1,
+	}
+	if module.MaxHTTPResponseBytes > 0 {
+		memory.MaxHttpResponseBytes = module.MaxHTTPResponseBytes
+	}
+	if module.MaxVarBytes > 0 {
+		memory.MaxVarBytes = module.MaxVarBytes
+	}
+	return memory
+}
+
+// memoryBudget allocates the linear memories of one instance, refusing to
+// grow any of them past max_memory_pages. The guest sees a refusal as a
+// failed memory.grow; the budget remembers it so that a failing call can
+// be attributed to the memory budget.
+type memoryBudget struct {
+	limit     uint64
+	refused   atomic.Bool
+	oversized atomic.Bool
+}
+
+func newMemoryBudget(pages uint32) *memoryBudget {
+	return &memoryBudget{limit: uint64(pages) * wasmPageSize}
+}
+
+// Allocate implements experimental.MemoryAllocator
+func (b *memoryBudget) Allocate(_, _ uint64) experimental.LinearMemory {
+	return &budgetedMemory{budget: b}
+}
+
+// budgetedMemory is a linear memory that grows within its budget
+type budgetedMemory struct {
+	budget      *memoryBudget
+	buf         []byte
+	initialized bool
+}
+
+// Reallocate implements experimental.LinearMemory. The initial allocation
+// must not fail, so a module whose memory starts above the budget is
+// flagged as oversized and its instance is discarded by the pool.
+func (m *budgetedMemory) Reallocate(size uint64) []byte {
+	if size > m.budget.limit {
+		if m.initialized {
+			m.budget.refused.Store(true)
+			return nil
+		}
+		m.budget.oversized.Store(true)
+	}
+	m.initialized = true
+	if size <= uint64(cap(m.buf)) {
+		m.buf = m.buf[:size]
+		return m.buf
+	}
+	// Grow geometrically to keep copies amortized, but never past the budget
+	capacity := max(size, min(2*uint64(cap(m.buf)), m.budget.limit))
+	grown := make([]byte, size, capacity)
+	copy(grown, m.buf)
+	m.buf = grown
+	return m.buf
+}
+
+// Free implements experimental.LinearMemory
+func (m *budgetedMemory) Free() {
+	m.buf = nil
+}
+
+// fuelMeter tracks the fuel consumed by a single call. One unit of fuel is
+// spent on every function entered by the guest, including host calls.
+type fuelMeter struct {
+	limit  uint64
+	used   atomic.Uint64
+	cancel context.CancelCauseFunc
+}
+
+type fuelMeterKey struct{}
+
+// withFuelMeter attaches a fuel meter to ctx. The returned context is
+// cancelled when the budget runs out, which interrupts the guest through
+// wazero's close-on-context-done.
+func withFuelMeter(ctx context.Context, limit uint64) (context.Context, *fuelMeter) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	meter := &fuelMeter{limit: limit, cancel: cancel}
+	return context.WithValue(ctx, fuelMeterKey{}, meter), meter
+}
+
+func (m *fuelMeter) exhausted() bool {
+	return m.used.Load() > m.limit
+}
+
+// extismHostModule is the module of the host functions extism provides
+const extismHostModule = "extism:host/env"
+
+// callListenerFactory returns the listeners of a module: var_set is always
+// watched so that failures in it can be attributed to the vars budget, and
+// every function is metered when the module has a fuel budget
+type callListenerFactory struct {
+	fuel bool
+}
+
+func (f callListenerFactory) NewFunctionListener(def api.FunctionDefinition) experimental.FunctionListener {
+	if def.ModuleName() == extismHostModule && def.Name() == "var_set" {
+		return callListener{watch: true}
+	}
+	if f.fuel {
+		return callListener{}
+	}
+	return nil
+}
+
+// callListener charges fuel to the meter found in the call context, if
+// any, and records in its hostCall whether a watched host function is
+// running
+type callListener struct {
+	watch bool
+}
+
+// hostCall names the watched host function a call is inside of. A host
+// function that fails never returns, so after a failed call it names the
+// function that raised the failure.
+type hostCall struct {
+	name string
+}
+
+type hostCallKey struct{}
+
+// withHostCall attaches a hostCall to ctx
+func withHostCall(ctx context.Context) (context.Context, *hostCall) {
+	call := &hostCall{}
+	return context.WithValue(ctx, hostCallKey{}, call), call
+}
+
+func (l callListener) Before(ctx context.Context, _ api.Module, def api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	if l.watch {
+		if call, ok := ctx.Value(hostCallKey{}).(*hostCall); ok {
+			call.name = def.Name()
+		}
+	}
+	meter, ok := ctx.Value(fuelMeterKey{}).(*fuelMeter)
+	if !ok {
+		return
+	}
+	if meter.used.Add(1) > meter.limit {
+		meter.cancel(errFuelExhausted)
+	}
+}
+
+func (l callListener) After(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64) {
+	if l.watch {
+		if call, ok := ctx.Value(hostCallKey{}).(*hostCall); ok {
+			call.name = ""
+		}
+	}
+}
+
+func (callListener) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+// exhaustedResource reports which budget, if any, caused a failed call:
+// a failure inside var_set, an HTTP body cut off at its limit, or a memory
+// the budget refused to grow during the call
+func exhaustedResource(budget *memoryBudget, call *hostCall, err error) string {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case call.name == "var_set":
+		return ResourceVars
+	case errors.As(err, &tooLarge):
+		return ResourceHTTPResponse
+	case budget != nil && budget.refused.Load():
+		return ResourceMemory
+	}
+	return ""
+}
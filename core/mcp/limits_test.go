@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memoryHogWASM is a module whose memory starts at 17 pages. grow calls
+// memory.grow until it fails and then traps; trap traps straight away.
+var memoryHogWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type: () -> i32
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	// functions: grow, trap
+	0x03, 0x03, 0x02, 0x00, 0x00,
+	// memory: min 17 pages
+	0x05, 0x03, 0x01, 0x00, 0x11,
+	// exports: memory, grow, trap
+	0x07, 0x18, 0x03,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x04, 'g', 'r', 'o', 'w', 0x00, 0x00,
+	0x04, 't', 'r', 'a', 'p', 0x00, 0x01,
+	// code
+	0x0a, 0x15, 0x02,
+	// grow: loop { br_if (memory.grow 1) != -1 }; unreachable
+	0x0f, 0x00, 0x03, 0x40, 0x41, 0x01, 0x40, 0x00, 0x41, 0x7f, 0x47, 0x0d, 0x00, 0x0b, 0x00, 0x0b,
+	// trap: unreachable
+	0x03, 0x00, 0x00, 0x0b,
+}
+
+func memoryHogModule(t *testing.T, pages uint32) Module {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hog.wasm")
+	if err := os.WriteFile(path, memoryHogWASM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Module{
+		Name:           "hog",
+		WASMPath:       "file://" + path,
+		MaxMemoryPages: pages,
+		Tools:          []Tool{{Name: "grow"}, {Name: "trap"}},
+	}
+}
+
+func TestMemoryBudgetExhausted(t *testing.T) {
+	w := newTestEngine(t, memoryHogModule(t, 32))
+
+	_, err := w.CallTool(context.Background(), "hog", "grow", nil)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeResourceExhausted {
+		t.Fatalf("grow past the budget: error %v, want %s", err, ErrCodeResourceExhausted)
+	}
+	if n := w.Stats().ResourceExhausted()[ResourceKey{Module: "hog", Resource: ResourceMemory}]; n != 1 {
+		t.Errorf("memory exhaustion counted %d times, want 1", n)
+	}
+}
+
+func TestTrapAtMemoryBudgetIsNotExhaustion(t *testing.T) {
+	// The memory starts at the budget, but the trap has nothing to do with it
+	w := newTestEngine(t, memoryHogModule(t, 17))
+
+	_, err := w.CallTool(context.Background(), "hog", "trap", nil)
+	if err == nil {
+		t.Fatal("trap succeeded")
+	}
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) && toolErr.Code == ErrCodeResourceExhausted {
+		t.Errorf("trap reported as %v", toolErr)
+	}
+	if n := len(w.Stats().ResourceExhausted()); n != 0 {
+		t.Errorf("budget violations counted: %v", w.Stats().ResourceExhausted())
+	}
+}
+
+func TestMemoryBudgetTooSmall(t *testing.T) {
+	w := NewWASMEngine(&Config{SignaturePolicy: SignaturePolicyOff})
+	defer w.Close(context.Background())
+	if err := w.LoadModule(context.Background(), memoryHogModule(t, 16)); err == nil {
+		t.Error("module whose memory starts above max_memory_pages loaded")
+	}
+}
+
+// varHogWASM exports vars, which stores a 2 KiB extism variable
+var varHogWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i64) -> i64, (i64, i64) -> (), () -> i32
+	0x01, 0x0f, 0x03,
+	0x60, 0x01, 0x7e, 0x01, 0x7e,
+	0x60, 0x02, 0x7e, 0x7e, 0x00,
+	0x60, 0x00, 0x01, 0x7f,
+	// imports: extism:host/env alloc and var_set
+	0x02, 0x33, 0x02,
+	0x0f, 'e', 'x', 't', 'i', 's', 'm', ':', 'h', 'o', 's', 't', '/', 'e', 'n', 'v',
+	0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+	0x0f, 'e', 'x', 't', 'i', 's', 'm', ':', 'h', 'o', 's', 't', '/', 'e', 'n', 'v',
+	0x07, 'v', 'a', 'r', '_', 's', 'e', 't', 0x00, 0x01,
+	// functions: vars
+	0x03, 0x02, 0x01, 0x02,
+	// exports: vars
+	0x07, 0x08, 0x01, 0x04, 'v', 'a', 'r', 's', 0x00, 0x02,
+	// code: var_set(alloc(1), alloc(2048)); return 0
+	0x0a, 0x11, 0x01,
+	0x0f, 0x00, 0x42, 0x01, 0x10, 0x00, 0x42, 0x80, 0x10, 0x10, 0x00, 0x10, 0x01, 0x41, 0x00, 0x0b,
+}
+
+func TestVarBudgetExhausted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vars.wasm")
+	if err := os.WriteFile(path, varHogWASM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	module := Module{Name: "vars", WASMPath: "file://" + path, Tools: []Tool{{Name: "vars"}}}
+
+	// Within the default budget the variable is stored
+	w := newTestEngine(t, module)
+	if _, err := w.CallTool(context.Background(), "vars", "vars", nil); err != nil {
+		t.Fatalf("vars within the budget: %v", err)
+	}
+
+	module.MaxVarBytes = 1024
+	w = newTestEngine(t, module)
+	_, err := w.CallTool(context.Background(), "vars", "vars", nil)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeResourceExhausted {
+		t.Fatalf("vars past the budget: error %v, want %s", err, ErrCodeResourceExhausted)
+	}
+	if n := w.Stats().ResourceExhausted()[ResourceKey{Module: "vars", Resource: ResourceVars}]; n != 1 {
+		t.Errorf("vars exhaustion counted %d times, want 1", n)
+	}
+}
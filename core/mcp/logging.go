@@ -0,0 +1,331 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats selectable with logging.format
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LoggingConfig configures the server log. Level is debug, info, warn or
+// error and Format is text or json; both are read at startup.
+type LoggingConfig struct {
+	Level  string       `yaml:"level"`
+	Format string       `yaml:"format"`
+	Redact RedactConfig `yaml:"redact"`
+}
+
+// RedactConfig limits what tool payloads reveal in the log. The values of
+// the named arguments are masked wherever they appear in the arguments,
+// and logged arguments and outputs are cut to MaxPayloadBytes: zero keeps
+// the default, a negative value leaves payloads out entirely.
+type RedactConfig struct {
+	Arguments       []string `yaml:"arguments"`
+	MaxPayloadBytes int      `yaml:"max_payload_bytes"`
+}
+
+const (
+	defaultMaxPayloadBytes = 256
+	redactedValue          = "[REDACTED]"
+)
+
+// requestIDHeader carries the request ID in and out of the HTTP server
+const requestIDHeader = "X-Request-ID"
+
+// ParseLogLevel parses debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+}
+
+// NewLogHandler creates the handler the server is meant to log through.
+// Records logged with a request context are tagged with the request ID,
+// the MCP session ID and the trace ID, and are also sent to MCP clients
+// that asked for them with logging/setLevel. The debug level adds the
+// source location of each record.
+func NewLogHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level, AddSource: level <= slog.LevelDebug}
+	var h slog.Handler
+	switch format {
+	case "", LogFormatText:
+		h = slog.NewTextHandler(w, opts)
+	case LogFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	return contextHandler{h}, nil
+}
+
+// contextHandler adds request-scoped attributes to records and forwards
+// them to the MCP session they belong to
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next.Enabled(ctx, level) {
+		return true
+	}
+	clientLevel, ok := sessionLogLevel(ctx)
+	return ok && level >= clientLevel
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		r.AddAttrs(slog.String("session_id", session.SessionID()))
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		r.AddAttrs(slog.String("principal", principal.Name))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+
+	if clientLevel, ok := sessionLogLevel(ctx); ok && r.Level >= clientLevel {
+		sendLogToClient(ctx, r)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.next.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.next.WithGroup(name)}
+}
+
+// loggingSessions holds the sessions that called logging/setLevel. Only
+// those receive log notifications: the session's level starts at error,
+// and unsolicited notifications would turn plain JSON responses into
+// event streams.
+var loggingSessions sync.Map
+
+// addLoggingHooks tracks which sessions asked for log notifications
+func addLoggingHooks(hooks *server.Hooks) {
+	hooks.AddAfterSetLevel(func(ctx context.Context, id any, message *mcp.SetLevelRequest, result *mcp.EmptyResult) {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			loggingSessions.Store(session.SessionID(), true)
+			slog.InfoContext(ctx, "Client changed its log level", "client_level", message.Params.Level)
+		}
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		loggingSessions.Delete(session.SessionID())
+	})
+}
+
+// sessionLogLevel returns the level the session of ctx asked for
+func sessionLogLevel(ctx context.Context) (slog.Level, bool) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return 0, false
+	}
+	if _, ok := loggingSessions.Load(session.SessionID()); !ok {
+		return 0, false
+	}
+	logging, ok := session.(server.SessionWithLogging)
+	if !ok {
+		return 0, false
+	}
+	return slogLevel(logging.GetLogLevel()), true
+}
+
+// slogLevel maps the syslog levels of MCP onto the four slog levels
+func slogLevel(level mcp.LoggingLevel) slog.Level {
+	switch level {
+	case mcp.LoggingLevelDebug:
+		return slog.LevelDebug
+	case mcp.LoggingLevelInfo, mcp.LoggingLevelNotice:
+		return slog.LevelInfo
+	case mcp.LoggingLevelWarning:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+func mcpLevel(level slog.Level) mcp.LoggingLevel {
+	switch {
+	case level >= slog.LevelError:
+		return mcp.LoggingLevelError
+	case level >= slog.LevelWarn:
+		return mcp.LoggingLevelWarning
+	case level >= slog.LevelInfo:
+		return mcp.LoggingLevelInfo
+	default:
+		return mcp.LoggingLevelDebug
+	}
+}
+
+// sendLogToClient sends a record as a notifications/message to the
+// session of ctx. Failures are dropped: logging them would recurse.
+func sendLogToClient(ctx context.Context, r slog.Record) {
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	data := map[string]any{"message": r.Message}
+	r.Attrs(func(a slog.Attr) bool {
+		v := a.Value.Resolve()
+		if v.Kind() == slog.KindDuration {
+			data[a.Key] = v.Duration().String()
+		} else {
+			data[a.Key] = v.Any()
+		}
+		return true
+	})
+	srv.SendLogMessageToClient(ctx, mcp.NewLoggingMessageNotification(mcpLevel(r.Level), "danp-engine", data))
+}
+
+type requestIDKey struct{}
+
+// withRequestID returns a context whose log records carry id
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ensureRequestID gives ctx a request ID unless the transport already did
+func ensureRequestID(ctx context.Context) context.Context {
+	if requestIDFromContext(ctx) != "" {
+		return ctx
+	}
+	return withRequestID(ctx, uuid.NewString())
+}
+
+// assignRequestIDs gives every HTTP request an ID, taken from the
+// X-Request-ID header when the caller sent a usable one, and echoes it in
+// the response
+func assignRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// logToolCalls gives tool calls a request ID on transports that do not
+// assign one, such as stdio
+func logToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return next(ensureRequestID(ctx), request)
+	}
+}
+
+// formatArguments renders tool arguments for the log, masking redacted
+// names and truncating the result. It returns "" when payloads are off.
+func (r RedactConfig) formatArguments(args map[string]any) string {
+	if r.MaxPayloadBytes < 0 {
+		return ""
+	}
+	data, err := json.Marshal(r.mask(args))
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return r.truncate(data)
+}
+
+// formatPayload renders a raw tool input or output for the log
+func (r RedactConfig) formatPayload(data []byte) string {
+	if r.MaxPayloadBytes < 0 {
+		return ""
+	}
+	return r.truncate(data)
+}
+
+func (r RedactConfig) truncate(data []byte) string {
+	limit := r.MaxPayloadBytes
+	if limit == 0 {
+		limit = defaultMaxPayloadBytes
+	}
+	if len(data) <= limit {
+		return string(data)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", strings.ToValidUTF8(string(data[:limit]), ""), len(data))
+}
+
+// mask replaces the values of redacted keys at any depth
+func (r RedactConfig) mask(value any) any {
+	if len(r.Arguments) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, val := range v {
+			if r.redacts(key) {
+				out[key] = redactedValue
+			} else {
+				out[key] = r.mask(val)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = r.mask(val)
+		}
+		return out
+	}
+	return value
+}
+
+func (r RedactConfig) redacts(key string) bool {
+	for _, name := range r.Arguments {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
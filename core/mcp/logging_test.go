@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// redactedHelloModule greets by name; the module only ever sees the name,
+// so any secret in the log comes from the server's own records
+func redactedHelloModule() Module {
+	return sayHelloModule(Tool{
+		InputMode: InputSingleArgRaw,
+		InputArg:  "name",
+		Inputs: []ToolInput{
+			{Name: "name", Type: TypeString, Required: true},
+			{Name: "password", Type: TypeString},
+			{Name: "options", Type: TypeObject},
+		},
+	})
+}
+
+// secretArguments holds values that must never reach the log
+var secretArguments = map[string]any{
+	"name":     "Bob",
+	"password": "hunter2",
+	"options":  map[string]any{"API_Key": "sk-secret", "retries": 3},
+}
+
+// captureLog routes the default logger through the server's log handler
+// into a buffer until the test ends
+func captureLog(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	handler, err := NewLogHandler(&buf, LogFormatJSON, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestDebugLogRedactsArguments(t *testing.T) {
+	buf := captureLog(t, slog.LevelDebug)
+	w := NewWASMEngine(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Logging:         LoggingConfig{Redact: RedactConfig{Arguments: []string{"password", "api_key"}}},
+	})
+	defer w.Close(context.Background())
+	if err := w.LoadModule(context.Background(), redactedHelloModule()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.CallTool(context.Background(), "hello", "say_hello", secretArguments); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Calling WASM function") || !strings.Contains(out, redactedValue) {
+		t.Fatalf("debug log has no redacted arguments:\n%s", out)
+	}
+	for _, secret := range []string{"hunter2", "sk-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("debug log contains the redacted value %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestRedactConfigPayloads(t *testing.T) {
+	tests := []struct {
+		name   string
+		redact RedactConfig
+		want   string
+	}{
+		{name: "default limit", redact: RedactConfig{}, want: strings.Repeat("x", defaultMaxPayloadBytes) + "... (300 bytes)"},
+		{name: "custom limit", redact: RedactConfig{MaxPayloadBytes: 4}, want: "xxxx... (300 bytes)"},
+		{name: "payloads off", redact: RedactConfig{MaxPayloadBytes: -1}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.redact.formatPayload(bytes.Repeat([]byte("x"), 300)); got != tt.want {
+			t.Errorf("%s: formatPayload = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetLevelSendsLogsToSession(t *testing.T) {
+	captureLog(t, slog.LevelInfo)
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Modules:         []Module{redactedHelloModule()},
+		Logging:         LoggingConfig{Redact: RedactConfig{Arguments: []string{"password", "api_key"}}},
+	})
+	defer s.wasmEngine.Close(context.Background())
+	session := newTestSession(t, s)
+	ctx := s.server.WithContext(context.Background(), session)
+
+	call := func() {
+		t.Helper()
+		args, _ := json.Marshal(secretArguments)
+		resp := s.server.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 2, "method": "tools/call",
+			"params": {"name": "say_hello", "arguments": `+string(args)+`}}`))
+		if _, ok := resp.(mcp.JSONRPCResponse); !ok {
+			t.Fatalf("tools/call answered %+v", resp)
+		}
+	}
+	// debugLogs drains the session and returns the debug log messages it got
+	debugLogs := func() []string {
+		var logs []string
+		for {
+			select {
+			case notification := <-session.notifications:
+				if notification.Method != "notifications/message" || notification.Params.AdditionalFields["level"] != mcp.LoggingLevelDebug {
+					continue
+				}
+				data, _ := json.Marshal(notification.Params.AdditionalFields["data"])
+				logs = append(logs, string(data))
+			default:
+				return logs
+			}
+		}
+	}
+
+	call()
+	if logs := debugLogs(); len(logs) != 0 {
+		t.Fatalf("session got debug logs before logging/setLevel: %v", logs)
+	}
+
+	resp := s.server.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "logging/setLevel", "params": {"level": "debug"}}`))
+	if _, ok := resp.(mcp.JSONRPCResponse); !ok {
+		t.Fatalf("logging/setLevel answered %+v", resp)
+	}
+	call()
+	logs := debugLogs()
+	if !strings.Contains(strings.Join(logs, "\n"), "Calling WASM function") {
+		t.Fatalf("session got no debug log of the call after logging/setLevel: %v", logs)
+	}
+	for _, log := range logs {
+		if strings.Contains(log, "hunter2") || strings.Contains(log, "sk-secret") {
+			t.Errorf("log notification contains a redacted value: %s", log)
+		}
+	}
+}
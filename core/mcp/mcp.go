@@ -3,43 +3,114 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
-	"strings"
-	"time"
-
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-	"gopkg.in/yaml.v3"
 )
 
 // MCPServer represents the core MCP server implementation
 type MCPServer struct {
-	server          *server.MCPServer
-	config          *Config
-	wasmEngine      *WASMEngine
-	registeredTools []string
+	server     *server.MCPServer
+	config     *Config
+	configPath string
+	wasmEngine *WASMEngine
+
+	// mu guards config, modules and httpServer; changeMu serializes
+	// reloads and admin changes to the module set
+	mu         sync.RWMutex
+	changeMu   sync.Mutex
+	modules    map[string]*moduleState
+	httpServer *http.Server
+
+	// listenAddr overrides the manifest host and port when set
+	listenAddr string
+
+	// stopCtx is cancelled when Stop begins; streams tracks WebSocket
+	// connections, which http.Server.Shutdown does not wait for
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+	streams    sync.WaitGroup
+
+	// wsTickets holds the one-time credentials of browser WebSocket clients
+	wsTickets wsTickets
+
+	// shutdownTracing flushes and stops the tracer provider
+	shutdownTracing func(context.Context) error
+
+	// configAuth holds the authenticators of the manifest's auth block and
+	// customAuth those added with AddAuthenticator; both are guarded by mu.
+	// walletAuth keeps wallet sessions across reloads.
+	configAuth []Authenticator
+	customAuth []Authenticator
+	walletAuth *walletAuthenticator
+
+	// ipfsProbe caches the gateway check of the readiness probe
+	ipfsProbe ipfsProbe
 }
 
-// Config holds MCP server configuration
+// Config holds MCP server configuration.
+// The server settings may be given at the top level or nested under
+// server_config; LoadConfig merges the nested block into the flat fields.
 type Config struct {
 	Host           string        `yaml:"host"`
 	Port           int           `yaml:"port"`
 	MaxConnections int           `yaml:"max_connections"`
 	Timeout        time.Duration `yaml:"timeout"`
+	Transports     []string      `yaml:"transports"`
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	ServerConfig   *ServerConfig `yaml:"server_config"`
+	Admin          AdminConfig   `yaml:"admin"`
 	LLMConfig      LLMConfig     `yaml:"llm_config"`
 	Modules        []Module      `yaml:"modules"`
 	IPFS           IPFSConfig    `yaml:"ipfs"`
+	Tracing        TracingConfig `yaml:"tracing"`
+	Metrics        MetricsConfig `yaml:"metrics"`
+	Logging        LoggingConfig `yaml:"logging"`
+	Auth           AuthConfig    `yaml:"auth"`
+
+	// SignaturePolicy decides what happens to modules whose publisher
+	// signature does not verify: enforce, warn or off. Unset, it is warn
+	// for modules that name a publisher and off for the others.
+	SignaturePolicy string `yaml:"signature_policy"`
+}
+
+// ServerConfig holds the listener settings of the server_config block
+type ServerConfig struct {
+	Host           string        `yaml:"host"`
+	Port           int           `yaml:"port"`
+	MaxConnections int           `yaml:"max_connections"`
+	Timeout        time.Duration `yaml:"timeout"`
+	Transports     []string      `yaml:"transports"`
+	AllowedOrigins []string      `yaml:"allowed_origins"`
 }
 
 type IPFSConfig struct {
-	Enable    bool      `yaml:"enable"`
-	LassieNet LassieNet `yaml:"lassie_net"`
-	CIDS      []string  `yaml:"cids"`
+	Enable    bool            `yaml:"enable"`
+	LassieNet LassieNet       `yaml:"lassie_net"`
+	CIDS      []string        `yaml:"cids"`
+	Cache     IPFSCacheConfig `yaml:"cache"`
+
+	// Offline serves modules from the cache only, never the gateway
+	Offline bool `yaml:"offline"`
+
+	// MaxResponseBytes bounds each gateway response (default 256 MiB)
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+}
+
+// IPFSCacheConfig locates the on-disk cache of retrieved modules. Without
+// a directory nothing is cached.
+type IPFSCacheConfig struct {
+	Dir      string `yaml:"dir"`
+	MaxBytes int64  `yaml:"max_bytes"`
 }
 
 type LassieNet struct {
@@ -48,6 +119,13 @@ type LassieNet struct {
 	Port   int    `yaml:"port"`
 }
 
+// AdminConfig secures the /admin API. When neither Token nor TokenEnv is
+// set, the API only accepts requests from the loopback interface.
+type AdminConfig struct {
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"`
+}
+
 // LLMConfig contains LLM provider configurations
 type LLMConfig struct {
 	BaseURL  string       `yaml:"base_url"`
@@ -63,132 +141,195 @@ type OpenAIConfig struct {
 	MaxTokens   int     `yaml:"max_tokens"`
 }
 
-// Module defines a WASM module and its exposed tools
+// Module defines a WASM module and its exposed tools.
+// The Max* memory fields and Fuel bound the resources a single instance may
+// use; zero leaves the corresponding limit at the runtime default. The
+// instance fields size the module's instance pool. /readyz fails while a
+// Required module is not loaded. Publisher is the address expected to have
+// signed the module's WASM; the signature is given inline, in
+// SignatureFile or as a .sig file in the module's CAR.
 type Module struct {
-	Name     string `yaml:"name"`
-	WASMPath string `yaml:"wasm_path"`
-	Tools    []Tool `yaml:"tools"`
+	Name                 string        `yaml:"name"`
+	WASMPath             string        `yaml:"wasm_path"`
+	Required             bool          `yaml:"required"`
+	Publisher            string        `yaml:"publisher"`
+	Signature            string        `yaml:"signature"`
+	SignatureFile        string        `yaml:"signature_file"`
+	Timeout              time.Duration `yaml:"timeout"`
+	MaxMemoryPages       uint32        `yaml:"max_memory_pages"`
+	MaxHTTPResponseBytes int64         `yaml:"max_http_response_bytes"`
+	MaxVarBytes          int64         `yaml:"max_var_bytes"`
+	Fuel                 uint64        `yaml:"fuel"`
+	MinInstances         int           `yaml:"min_instances"`
+	MaxInstances         int           `yaml:"max_instances"`
+	IdleTimeout          time.Duration `yaml:"idle_timeout"`
+	QueueTimeout         time.Duration `yaml:"queue_timeout"`
+	Tools                []Tool        `yaml:"tools"`
 }
 
-// Tool defines an MCP tool interface
+// Tool defines an MCP tool interface.
+// InputMode selects how arguments are encoded for the WASM export:
+// arguments_json (default), single_arg_raw (the value of InputArg),
+// template (InputTemplate rendered over the arguments) or msgpack.
+// AllowedPrincipals and Scopes restrict the tool to callers with one of
+// the listed principals, given as method:name, and every listed scope.
 type Tool struct {
-	Name        string      `yaml:"name"`
-	Description string      `yaml:"description"`
-	Inputs      []ToolInput `yaml:"inputs"`
-	Outputs     ToolOutput  `yaml:"outputs"`
+	Name              string        `yaml:"name"`
+	Description       string        `yaml:"description"`
+	Inputs            []ToolInput   `yaml:"inputs"`
+	Outputs           ToolOutput    `yaml:"outputs"`
+	InputMode         string        `yaml:"input_mode"`
+	InputArg          string        `yaml:"input_arg"`
+	InputTemplate     string        `yaml:"input_template"`
+	Timeout           time.Duration `yaml:"timeout"`
+	AllowedPrincipals []string      `yaml:"allowed_principals"`
+	Scopes            []string      `yaml:"scopes"`
 }
 
-// ToolInput defines tool input parameters
+// ToolInput defines tool input parameters.
+// Object inputs declare their fields in Properties, array inputs declare
+// their element type in Items; the remaining fields map onto the JSON
+// Schema keywords of the same name.
 type ToolInput struct {
-	Name        string `yaml:"name"`
-	Type        string `yaml:"type"`
-	Required    bool   `yaml:"required"`
-	Description string `yaml:"description"`
+	Name        string      `yaml:"name"`
+	Type        string      `yaml:"type"`
+	Required    bool        `yaml:"required"`
+	Description string      `yaml:"description"`
+	Properties  []ToolInput `yaml:"properties"`
+	Items       *ToolInput  `yaml:"items"`
+	Enum        []any       `yaml:"enum"`
+	Default     any         `yaml:"default"`
+	Minimum     *float64    `yaml:"minimum"`
+	Maximum     *float64    `yaml:"maximum"`
+	MinLength   *int        `yaml:"min_length"`
+	MaxLength   *int        `yaml:"max_length"`
+	MinItems    *int        `yaml:"min_items"`
+	MaxItems    *int        `yaml:"max_items"`
+	Pattern     string      `yaml:"pattern"`
 }
 
-// ToolOutput defines tool output structure
+// ToolOutput defines tool output structure.
+// Type is one of text, json, image, audio or resource_link; json outputs may
+// carry a JSON Schema, image and audio outputs require a MIME type.
 type ToolOutput struct {
-	Type        string `yaml:"type"`
-	Description string `yaml:"description"`
+	Type        string         `yaml:"type"`
+	Description string         `yaml:"description"`
+	MimeType    string         `yaml:"mime_type"`
+	Schema      map[string]any `yaml:"schema"`
 }
 
 // NewServer creates a new MCP server instance from config file
 func NewServer(configPath string) (*MCPServer, error) {
-	data, err := os.ReadFile(configPath)
+	config, err := LoadConfig(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, err
 	}
+	return NewServerFromConfig(config, configPath), nil
+}
 
-	return NewMCPServer(&config), nil
+// NewServerFromConfig creates a server from a manifest the caller already
+// loaded from configPath, which reloads read again
+func NewServerFromConfig(config *Config, configPath string) *MCPServer {
+	s := NewMCPServer(config)
+	s.configPath = configPath
+	return s
 }
 
 // NewMCPServer creates a new MCP server instance from config
 func NewMCPServer(config *Config) *MCPServer {
-	log.Println("Initializing new MCP server instance")
+	slog.Info("Initializing new MCP server instance")
+
+	// Tracing comes first so that the initial module loads are traced
+	shutdownTracing, err := setupTracing(config.Tracing)
+	if err != nil {
+		slog.Error("Failed to set up tracing, continuing without it", "error", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	hooks := &server.Hooks{}
 	wasmEngine := NewWASMEngine(config)
 
-	// Setup default hooks
+	// Log requests by method and ID only; tool arguments and results are
+	// logged, redacted, by the engine
 	hooks.AddBeforeAny(func(ctx context.Context, id any, method mcp.MCPMethod, message any) {
-		log.Printf("BeforeAny: %s, %v, %v\n", method, id, message)
+		slog.DebugContext(ctx, "MCP request", "method", method, "id", id)
 	})
 	hooks.AddOnSuccess(func(ctx context.Context, id any, method mcp.MCPMethod, message any, result any) {
-		log.Printf("OnSuccess: %s, %v, %v, %v\n", method, id, message, result)
+		slog.DebugContext(ctx, "MCP request succeeded", "method", method, "id", id)
 	})
 	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
-		log.Printf("OnError: %s, %v, %v, %v\n", method, id, message, err)
+		slog.WarnContext(ctx, "MCP request failed", "method", method, "id", id, "error", err)
 	})
+	addLoggingHooks(hooks)
+	wasmEngine.Metrics().addHooks(hooks)
+	(&requestSpans{}).addHooks(hooks)
 
-	log.Println("Creating MCP server with capabilities")
+	slog.Debug("Creating MCP server with capabilities")
 	mcpServer := server.NewMCPServer(
 		"dANP-MCP",
-		"1.0.0",
+		Version,
 		server.WithResourceCapabilities(true, true),
 		server.WithPromptCapabilities(true),
 		server.WithToolCapabilities(true),
 		server.WithLogging(),
 		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(traceToolCalls),
+		server.WithToolHandlerMiddleware(logToolCalls),
+		// Callers only see the tools they may call
+		server.WithToolFilter(wasmEngine.filterTools),
 	)
 
-	// Register WASM module tools from config
-	log.Printf("Registering %d WASM modules from config", len(config.Modules))
-	registeredTools := []string{}
-	for _, module := range config.Modules {
-		log.Printf("Processing module: %s (WASM path: %s)", module.Name, module.WASMPath)
-		log.Printf("Loading module with %d tools", len(module.Tools))
+	s := &MCPServer{
+		server:     mcpServer,
+		config:     config,
+		wasmEngine: wasmEngine,
+		modules:    make(map[string]*moduleState),
+		walletAuth: newWalletAuthenticator(config.Auth.Wallet),
 
-		if err := wasmEngine.LoadModule(context.Background(), module.WASMPath); err != nil {
-			log.Printf("Failed to load WASM module %s: %v", module.WASMPath, err)
-			continue
-		}
-
-		log.Printf("Registering tools for module: %s", module.Name)
-		if err := wasmEngine.RegisterWASMTools(mcpServer, module.WASMPath, module.Tools); err != nil {
-			log.Printf("Failed to register tools from WASM module %s: %v", module.WASMPath, err)
-		} else {
-			log.Printf("Successfully registered %d tools for module: %s", len(module.Tools), module.Name)
-			for _, tool := range module.Tools {
-				registeredTools = append(registeredTools, tool.Name)
-			}
-		}
+		shutdownTracing: shutdownTracing,
 	}
+	s.configAuth = newConfigAuthenticators(config.Auth, s.walletAuth)
+	s.stopCtx, s.stopCancel = context.WithCancel(context.Background())
 
-	return &MCPServer{
-		server:          mcpServer,
-		config:          config,
-		wasmEngine:      wasmEngine,
-		registeredTools: registeredTools,
+	// Register WASM module tools from config
+	slog.Info("Registering WASM modules from config", "modules", len(config.Modules))
+	var changes toolChanges
+	for _, module := range config.Modules {
+		slog.Info("Processing module", "module", module.Name, "wasm_path", module.WASMPath, "tools", len(module.Tools))
+		s.installModule(context.Background(), module, OriginManifest, &changes)
 	}
+	changes.apply(mcpServer)
+	go s.prefetchCIDs(s.stopCtx, config)
+
+	return s
 }
 
-// Start begins the MCP server
+// Start begins the MCP server. It blocks until the server fails or Stop
+// is called, in which case it returns nil.
 func (s *MCPServer) Start() error {
-	log.Println("Starting MCP server")
-	if s.config.Host == "" {
-		s.config.Host = "0.0.0.0"
-		log.Println("Using default host: 0.0.0.0")
+	slog.Info("Starting MCP server")
+	config := s.currentConfig()
+	host, port := config.Host, config.Port
+	if s.listenAddr != "" {
+		host, port = splitListenAddr(s.listenAddr)
 	}
-	if s.config.Port == 0 {
-		s.config.Port = 18080
-		log.Println("Using default port: 18080")
+	if host == "" {
+		host = "0.0.0.0"
+		slog.Info("Using default host", "host", host)
+	}
+	if port == 0 {
+		port = 18080
+		slog.Info("Using default port", "port", port)
 	}
-
-	// Create HTTP server with MCP server
-	httpServer := server.NewStreamableHTTPServer(s.server)
 
 	// Create a custom HTTP server with additional routes
 	mux := http.NewServeMux()
 
-	// Register the MCP server handler for the root path
-	mux.Handle("/", httpServer)
+	// Register the handlers of the enabled MCP transports
+	s.mountTransports(mux, config)
 
-	// Add a handler for /tools endpoint to list available tools
-	mux.HandleFunc("/tools", func(w http.ResponseWriter, r *http.Request) {
+	// Add a handler for /tools endpoint to list the tools the caller may use
+	mux.Handle("/tools", s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -196,107 +337,233 @@ func (s *MCPServer) Start() error {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"tools": s.registeredTools,
+			"tools": s.visibleToolNames(r.Context()),
 		})
-	})
+	})))
 
-	// Add handlers for individual tool endpoints
-	mux.HandleFunc("/tools/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	// Liveness and readiness probes
+	s.registerHealthRoutes(mux)
 
-		pathParts := strings.Split(r.URL.Path, "/")
-		if len(pathParts) < 3 {
-			http.Error(w, "Invalid tool path", http.StatusBadRequest)
-			return
-		}
+	// Sign-In with Ethereum
+	s.registerWalletAuthRoutes(mux)
 
-		toolName := pathParts[2]
-
-		// Find the tool in our config
-		var foundTool *Tool
-		var foundModule *Module
-
-		for i, module := range s.config.Modules {
-			for j, tool := range module.Tools {
-				if tool.Name == toolName {
-					foundTool = &s.config.Modules[i].Tools[j]
-					foundModule = &s.config.Modules[i]
-					break
-				}
-			}
-			if foundTool != nil {
-				break
-			}
-		}
+	// Prometheus metrics of tool calls, instance pools, module loads,
+	// IPFS retrievals and sessions
+	mux.Handle("/metrics", s.metricsHandler())
 
-		if foundTool == nil {
-			http.Error(w, "Tool not found", http.StatusNotFound)
-			return
-		}
-
-		// Read raw request body
-		bodyBytes, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
-			return
-		}
+	// Serve the OpenAPI contract of the REST gateway
+	mux.Handle("/openapi.json", s.requireAuth(http.HandlerFunc(s.handleOpenAPI)))
 
-		// Get the WASM plugin
-		wasmEngine := NewWASMEngine(s.config)
-		if err := wasmEngine.LoadModule(r.Context(), foundModule.WASMPath); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to load WASM module: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		plugin, ok := wasmEngine.plugins[foundModule.WASMPath]
-		if !ok {
-			http.Error(w, "WASM module not loaded", http.StatusInternalServerError)
-			return
-		}
+	// Add handlers for individual tool endpoints
+	mux.Handle("/tools/{name}", s.requireAuth(http.HandlerFunc(s.handleToolCall)))
 
-		// Call the WASM function with raw input
-		input := bodyBytes
+	// Module management and manifest reloads
+	s.registerAdminRoutes(mux)
 
-		log.Printf("Calling WASM function: %s with input: %s", toolName, string(input))
-		_, output, err := plugin.Plugin.Call(toolName, input)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("WASM call failed: %v", err), http.StatusInternalServerError)
-			return
+	if len(s.authenticators()) == 0 {
+		if restricted := s.restrictedTools(); len(restricted) > 0 {
+			slog.Warn("Tools restrict their callers but no authentication is configured, so they cannot be called", "tools", restricted)
 		}
-
-		// Return the result
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(output)
-	})
+	}
 
 	// Start the HTTP server
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	log.Printf("MCP server listening on %s", addr)
-	log.Printf("Server configuration: %+v", s.config)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	slog.Info("MCP server listening", "addr", addr, "transports", config.enabledTransports(),
+		"modules", len(config.Modules), "max_connections", config.MaxConnections, "timeout", config.Timeout)
 
 	server := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: traceHTTP(assignRequestIDs(mux)),
+	}
+
+	s.mu.Lock()
+	if s.stopCtx.Err() != nil {
+		s.mu.Unlock()
+		return errors.New("server is shutting down")
+	}
+	s.httpServer = server
+	s.mu.Unlock()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if config.MaxConnections > 0 {
+		slog.Info("Limiting concurrent connections", "max_connections", config.MaxConnections)
+		listener = newLimitListener(listener, config.MaxConnections)
+	}
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeStdio serves MCP over stdin and stdout, the transport desktop MCP
+// hosts use to launch servers, and returns when stdin is closed or ctx is
+// done. Only the MCP protocol is served: the REST, OpenAPI and admin
+// endpoints need the HTTP transport. Stdout carries the protocol, so
+// nothing else may write to it; the server logs to stderr.
+func (s *MCPServer) ServeStdio(ctx context.Context) error {
+	slog.Info("Starting MCP server on stdio")
+	stdio := server.NewStdioServer(s.server)
+	stdio.SetErrorLogger(slog.NewLogLogger(slog.Default().Handler(), slog.LevelError))
+
+	err := stdio.Listen(ctx, os.Stdin, os.Stdout)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	slog.Info("MCP stdio stream closed")
+	return nil
+}
+
+// SetListenAddr overrides the host and port from the manifest with a
+// host:port address; it must be called before Start
+func (s *MCPServer) SetListenAddr(addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid listen address %q: port must be between 1 and 65535", addr)
 	}
+	s.listenAddr = net.JoinHostPort(host, strconv.Itoa(port))
+	return nil
+}
 
-	return server.ListenAndServe()
+// SetWallet makes the node sign a receipt for every tool result with
+// wallet; it must be called before Start
+func (s *MCPServer) SetWallet(wallet *Wallet) {
+	s.wasmEngine.SetSigner(wallet)
 }
 
-// Stop gracefully shuts down the MCP server
+// splitListenAddr splits an address already checked by SetListenAddr
+func splitListenAddr(addr string) (string, int) {
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// Stop gracefully shuts down the MCP server. It stops accepting connections,
+// ends idle session streams and waits until ctx is done for in-flight
+// requests and WASM calls to finish, then closes every plugin. All errors
+// met along the way are returned together.
 func (s *MCPServer) Stop(ctx context.Context) error {
-	log.Println("Initiating MCP server shutdown")
+	slog.Info("Initiating MCP server shutdown")
+	s.stopCancel()
+
+	var errs []error
+	s.mu.RLock()
+	httpServer := s.httpServer
+	s.mu.RUnlock()
+	if httpServer != nil {
+		slog.Info("Waiting for in-flight requests to finish")
+		if err := httpServer.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down HTTP server", "error", err)
+			errs = append(errs, fmt.Errorf("failed to shut down HTTP server: %w", err))
+		}
+	}
+	if err := waitGroup(ctx, &s.streams); err != nil {
+		slog.Warn("WebSocket sessions still open at shutdown", "error", err)
+		errs = append(errs, fmt.Errorf("WebSocket sessions still open: %w", err))
+	}
+
+	// Hold changeMu so that no reload or admin change races the shutdown
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
 
 	// Close WASM resources
-	wasmEngine := NewWASMEngine(s.config)
-	if err := wasmEngine.Close(ctx); err != nil {
-		log.Printf("Error closing WASM resources: %v", err)
+	if err := s.wasmEngine.Close(ctx); err != nil {
+		slog.Error("Error closing WASM resources", "error", err)
+		errs = append(errs, fmt.Errorf("failed to close WASM modules: %w", err))
 	}
 
-	// TODO: Add additional cleanup if needed
+	// Flush the spans of the shutdown itself
+	if err := s.shutdownTracing(ctx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+		errs = append(errs, fmt.Errorf("failed to flush traces: %w", err))
+	}
 
-	log.Println("MCP server shutdown complete")
-	return nil
+	slog.Info("MCP server shutdown complete")
+	return errors.Join(errs...)
+}
+
+// waitGroup waits for wg until ctx is done
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeStreamsOnStop ends long-lived GET streams when Stop begins. Those
+// streams never go idle, so http.Server.Shutdown would otherwise wait on
+// them until its deadline; POST requests keep their context so in-flight
+// tool calls can finish.
+func (s *MCPServer) closeStreamsOnStop(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(s.stopCtx, cancel)
+			defer stop()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitListener caps the number of simultaneously open connections.
+// Accept blocks while the limit is reached, leaving further clients in the
+// kernel backlog until a connection closes.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{Listener: l, sem: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// Close unblocks a pending Accept as well as closing the listener
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn frees its listener slot once, on the first Close
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
 }
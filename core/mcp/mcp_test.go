@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spinWASM exports spin, which counts to 2^22 before returning
+var spinWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type: () -> i32
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	// functions: spin
+	0x03, 0x02, 0x01, 0x00,
+	// exports: spin
+	0x07, 0x08, 0x01, 0x04, 's', 'p', 'i', 'n', 0x00, 0x00,
+	// code
+	0x0a, 0x1a, 0x01,
+	// spin: loop { br_if (local.tee 0 (local.get 0 + 1)) != 2^22 }; return 0
+	0x18, 0x01, 0x01, 0x7f,
+	0x03, 0x40, 0x20, 0x00, 0x41, 0x01, 0x6a, 0x22, 0x00,
+	0x41, 0x80, 0x80, 0x80, 0x02, 0x47, 0x0d, 0x00, 0x0b,
+	0x41, 0x00, 0x0b,
+}
+
+// freeAddr returns a loopback address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestStopWaitsForInFlightCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spin.wasm")
+	if err := os.WriteFile(path, spinWASM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Modules:         []Module{{Name: "spin", WASMPath: "file://" + path, Tools: []Tool{{Name: "spin"}}}},
+	})
+	addr := freeAddr(t)
+	if err := s.SetListenAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan error, 1)
+	go func() { started <- s.Start() }()
+
+	plugin, ok := s.wasmEngine.Plugin("spin")
+	if !ok {
+		t.Fatal("spin module not loaded")
+	}
+
+	type response struct {
+		status int
+		body   map[string]any
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		// Retry until the listener is up
+		for range 100 {
+			resp, err = http.Post("http://"+addr+"/tools/spin", "application/json", strings.NewReader("{}"))
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		responses <- response{status: resp.StatusCode, body: body, err: err}
+	}()
+
+	// Stop once the call is running
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		plugin.refMu.Lock()
+		active := plugin.active
+		plugin.refMu.Unlock()
+		if active > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tool call never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	select {
+	case resp := <-responses:
+		if resp.err != nil {
+			t.Fatalf("in-flight call failed: %v", resp.err)
+		}
+		if resp.status != http.StatusOK || resp.body["is_error"] == true {
+			t.Errorf("in-flight call answered %d %v, want a result", resp.status, resp.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight call never answered")
+	}
+	if err := <-started; err != nil {
+		t.Errorf("Start: %v", err)
+	}
+
+	plugin.pool.mu.Lock()
+	closed := plugin.pool.closed
+	plugin.pool.mu.Unlock()
+	if !closed {
+		t.Error("plugin still open after Stop")
+	}
+	if _, err := plugin.Call(context.Background(), "spin", nil); err == nil {
+		t.Error("plugin accepted a call after Stop")
+	}
+}
@@ -0,0 +1,264 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes every metric the server exports
+const metricsNamespace = "danp"
+
+// MetricsConfig configures /metrics. The metrics name every module and
+// tool, so they require the same credentials as the REST gateway unless
+// Public opens them to unauthenticated scrapers.
+type MetricsConfig struct {
+	Public bool `yaml:"public"`
+}
+
+// Metrics holds the Prometheus collectors of one engine. Every method is
+// safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests     *prometheus.CounterVec
+	sessions     prometheus.Gauge
+	toolCalls    *prometheus.CounterVec
+	toolErrors   *prometheus.CounterVec
+	toolDuration *prometheus.HistogramVec
+	poolWait     *prometheus.HistogramVec
+	loadDuration *prometheus.HistogramVec
+	loadFailures *prometheus.CounterVec
+	ipfsBytes    prometheus.Counter
+	ipfsDuration prometheus.Histogram
+	ipfsFailures prometheus.Counter
+}
+
+// newMetrics creates the collectors of an engine, including gauges that
+// read the engine's instance pools and resource counters at scrape time
+func newMetrics(w *WASMEngine) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "mcp_requests_total",
+			Help:      "MCP requests handled, by method and outcome.",
+		}, []string{"method", "status"}),
+		sessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "mcp_sessions_active",
+			Help:      "MCP sessions currently registered.",
+		}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tool_calls_total",
+			Help:      "Tool calls over MCP and REST, by outcome.",
+		}, []string{"module", "tool", "status"}),
+		toolErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tool_errors_total",
+			Help:      "Failed tool calls, by error code.",
+		}, []string{"module", "tool", "code"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "tool_call_duration_seconds",
+			Help:      "Tool call latency, from validation to the mapped result.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"module", "tool"}),
+		poolWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "wasm_pool_wait_seconds",
+			Help:      "Time calls waited for a WASM instance.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"module"}),
+		loadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "module_load_duration_seconds",
+			Help:      "Time to fetch, compile and warm a WASM module.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 3, 10),
+		}, []string{"module"}),
+		loadFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "module_load_failures_total",
+			Help:      "WASM module loads that failed.",
+		}, []string{"module"}),
+		ipfsBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ipfs_retrieve_bytes_total",
+			Help:      "Bytes retrieved from the IPFS gateway.",
+		}),
+		ipfsDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "ipfs_retrieve_duration_seconds",
+			Help:      "IPFS retrieval latency.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 3, 10),
+		}),
+		ipfsFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ipfs_retrieve_failures_total",
+			Help:      "IPFS retrievals that failed.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.sessions, m.toolCalls, m.toolErrors, m.toolDuration,
+		m.poolWait, m.loadDuration, m.loadFailures,
+		m.ipfsBytes, m.ipfsDuration, m.ipfsFailures,
+		engineCollector{w},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// metricsHandler serves /metrics, checking metrics.public on every request
+// so that a manifest reload can open or close it
+func (s *MCPServer) metricsHandler() http.Handler {
+	metrics := s.wasmEngine.Metrics().Handler()
+	protected := s.requireAuth(metrics)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.currentConfig().Metrics.Public {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// Registry returns the registry holding the collectors, so embedders can
+// add their own or gather the metrics directly
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// addHooks counts MCP requests and sessions from the server hooks
+func (m *Metrics) addHooks(hooks *server.Hooks) {
+	if m == nil {
+		return
+	}
+	hooks.AddOnSuccess(func(ctx context.Context, id any, method mcp.MCPMethod, message any, result any) {
+		m.requests.WithLabelValues(string(method), "ok").Inc()
+	})
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		m.requests.WithLabelValues(string(method), "error").Inc()
+	})
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		m.sessions.Inc()
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		m.sessions.Dec()
+	})
+}
+
+// observeToolCall records the outcome and latency of one tool call
+func (m *Metrics) observeToolCall(module, tool string, elapsed time.Duration, result *mcp.CallToolResult, err error) {
+	if m == nil {
+		return
+	}
+	m.toolDuration.WithLabelValues(module, tool).Observe(elapsed.Seconds())
+
+	code := ""
+	var toolErr *ToolError
+	switch {
+	case errors.As(err, &toolErr):
+		code = toolErr.Code
+	case errors.Is(err, errToolNotFound):
+		code = ErrCodeNotFound
+	case err != nil:
+		code = ErrCodeInternal
+	case result != nil && result.IsError:
+		code = "tool_error"
+	}
+	if code == "" {
+		m.toolCalls.WithLabelValues(module, tool, "ok").Inc()
+		return
+	}
+	m.toolCalls.WithLabelValues(module, tool, "error").Inc()
+	m.toolErrors.WithLabelValues(module, tool, code).Inc()
+}
+
+func (m *Metrics) observePoolWait(module string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.poolWait.WithLabelValues(module).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) observeModuleLoad(module string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.loadDuration.WithLabelValues(module).Observe(elapsed.Seconds())
+	if err != nil {
+		m.loadFailures.WithLabelValues(module).Inc()
+	}
+}
+
+// observeIPFSRetrieve matches ipfs.Client's retrieve observer
+func (m *Metrics) observeIPFSRetrieve(cid string, bytes int, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.ipfsDuration.Observe(elapsed.Seconds())
+	m.ipfsBytes.Add(float64(bytes))
+	if err != nil {
+		m.ipfsFailures.Inc()
+	}
+}
+
+// engineCollector reports the state of the loaded modules at scrape time
+type engineCollector struct {
+	w *WASMEngine
+}
+
+var (
+	poolInstancesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "wasm_pool", "instances"),
+		"WASM instances of a module, by state.",
+		[]string{"module", "state"}, nil)
+	poolCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "wasm_pool", "max_instances"),
+		"Maximum number of WASM instances of a module.",
+		[]string{"module"}, nil)
+	exhaustedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "module", "resource_exhausted_total"),
+		"Calls stopped for exceeding a resource budget.",
+		[]string{"module", "resource"}, nil)
+)
+
+func (c engineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolInstancesDesc
+	ch <- poolCapacityDesc
+	ch <- exhaustedDesc
+}
+
+func (c engineCollector) Collect(ch chan<- prometheus.Metric) {
+	c.w.mu.Lock()
+	plugins := make(map[string]*WASMPlugin, len(c.w.plugins))
+	for name, plugin := range c.w.plugins {
+		plugins[name] = plugin
+	}
+	c.w.mu.Unlock()
+
+	for name, plugin := range plugins {
+		idle, busy := plugin.pool.counts()
+		ch <- prometheus.MustNewConstMetric(poolInstancesDesc, prometheus.GaugeValue, float64(idle), name, "idle")
+		ch <- prometheus.MustNewConstMetric(poolInstancesDesc, prometheus.GaugeValue, float64(busy), name, "busy")
+		ch <- prometheus.MustNewConstMetric(poolCapacityDesc, prometheus.GaugeValue, float64(cap(plugin.pool.slots)), name)
+	}
+	for key, count := range c.w.stats.ResourceExhausted() {
+		ch <- prometheus.MustNewConstMetric(exhaustedDesc, prometheus.CounterValue, float64(count), key.Module, key.Resource)
+	}
+}
@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherMetric returns the series of the named metric whose labels include
+// every pair in labels
+func gatherMetric(t *testing.T, m *Metrics, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if want, ok := labels[pair.GetName()]; ok && want != pair.GetValue() {
+					continue series
+				}
+			}
+			return metric
+		}
+	}
+	return nil
+}
+
+func TestToolCallMetrics(t *testing.T) {
+	w := newTestEngine(t, sayHelloModule(Tool{Inputs: []ToolInput{{Name: "name", Type: "string", Required: true}}}))
+
+	if _, err := w.CallTool(context.Background(), "hello", "say_hello", map[string]any{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CallTool(context.Background(), "hello", "say_hello", map[string]any{}); err == nil {
+		t.Fatal("call without the required argument succeeded")
+	}
+
+	labels := map[string]string{"module": "hello", "tool": "say_hello"}
+	for status, want := range map[string]float64{"ok": 1, "error": 1} {
+		labels["status"] = status
+		metric := gatherMetric(t, w.Metrics(), "danp_tool_calls_total", labels)
+		if got := metric.GetCounter().GetValue(); got != want {
+			t.Errorf("danp_tool_calls_total{status=%q} = %v, want %v", status, got, want)
+		}
+	}
+	delete(labels, "status")
+	labels["code"] = ErrCodeInvalidArguments
+	if got := gatherMetric(t, w.Metrics(), "danp_tool_errors_total", labels).GetCounter().GetValue(); got != 1 {
+		t.Errorf("danp_tool_errors_total{code=%q} = %v, want 1", ErrCodeInvalidArguments, got)
+	}
+	delete(labels, "code")
+	histogram := gatherMetric(t, w.Metrics(), "danp_tool_call_duration_seconds", labels).GetHistogram()
+	if histogram.GetSampleCount() != 2 || histogram.GetSampleSum() <= 0 {
+		t.Errorf("danp_tool_call_duration_seconds recorded %d calls taking %vs, want 2 with a latency",
+			histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+}
+
+func TestMetricsEndpointAuth(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := AuthConfig{APIKeys: []APIKeyConfig{{Principal: "ops", Hash: HashAPIKey(key)}}}
+	tests := []struct {
+		name   string
+		config Config
+		key    string
+		want   int
+	}{
+		{name: "no auth configured", want: http.StatusOK},
+		{name: "no credentials", config: Config{Auth: auth}, want: http.StatusUnauthorized},
+		{name: "credentials", config: Config{Auth: auth}, key: key, want: http.StatusOK},
+		{name: "public", config: Config{Auth: auth, Metrics: MetricsConfig{Public: true}}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.SignaturePolicy = SignaturePolicyOff
+			s := NewMCPServer(&tt.config)
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			s.metricsHandler().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("GET /metrics: %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "danp_mcp_sessions_active") {
+				t.Errorf("GET /metrics served no metrics:\n%s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Module statuses reported by ListModules
+const (
+	ModuleLoaded = "loaded"
+	ModuleFailed = "failed"
+)
+
+// Module origins reported by ListModules
+const (
+	OriginManifest = "manifest"
+	OriginAdmin    = "admin"
+)
+
+// Errors returned by the module management methods
+var (
+	ErrModuleNotFound = errors.New("module not found")
+	ErrModuleConflict = errors.New("module conflict")
+)
+
+// ModuleInfo describes a module known to the server. Status is loaded while
+// a plugin serves the module; LastError keeps the most recent load failure,
+// which may leave a previous plugin serving.
+type ModuleInfo struct {
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Origin    string     `json:"origin"`
+	Source    string     `json:"source"`
+	Required  bool       `json:"required"`
+	Hash      string     `json:"hash,omitempty"`
+	Publisher string     `json:"publisher,omitempty"`
+	Exports   []string   `json:"exports"`
+	Tools     []string   `json:"tools"`
+	LoadedAt  *time.Time `json:"loaded_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// moduleState is the server's record of a module and where it came from
+type moduleState struct {
+	module Module
+	info   ModuleInfo
+}
+
+// toolChanges collects the tool registrations of one or more module
+// changes so that clients see them as a single tools/list_changed
+// notification
+type toolChanges struct {
+	add    []server.ServerTool
+	remove []string
+}
+
+// apply registers the collected changes with the MCP server. Removing and
+// adding tools separately would notify clients twice, so a batch that does
+// both replaces the whole tool set instead.
+func (c *toolChanges) apply(s *server.MCPServer) {
+	switch {
+	case len(c.remove) > 0 && len(c.add) > 0:
+		tools := s.ListTools()
+		for _, name := range c.remove {
+			delete(tools, name)
+		}
+		for _, tool := range c.add {
+			delete(tools, tool.Tool.Name)
+		}
+		all := make([]server.ServerTool, 0, len(tools)+len(c.add))
+		for _, tool := range tools {
+			all = append(all, *tool)
+		}
+		s.SetTools(append(all, c.add...)...)
+	case len(c.remove) > 0:
+		s.DeleteTools(c.remove...)
+	case len(c.add) > 0:
+		s.AddTools(c.add...)
+	}
+	c.add, c.remove = nil, nil
+}
+
+// ListModules returns every known module, sorted by name
+func (s *MCPServer) ListModules() []ModuleInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	modules := make([]ModuleInfo, 0, len(s.modules))
+	for _, state := range s.modules {
+		modules = append(modules, state.info)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+	return modules
+}
+
+// Module returns the status of the named module
+func (s *MCPServer) Module(name string) (ModuleInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.modules[name]
+	if !ok {
+		return ModuleInfo{}, false
+	}
+	return state.info, true
+}
+
+// LoadModule loads a module at runtime, outside the manifest. The module
+// must not share its name or any tool name with a loaded module; use
+// ReloadModule to replace a module.
+func (s *MCPServer) LoadModule(ctx context.Context, module Module) error {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	if err := ValidateModule(s.currentConfig(), module); err != nil {
+		return err
+	}
+	if info, ok := s.Module(module.Name); ok && info.Status != ModuleFailed {
+		return fmt.Errorf("%w: module %s is already loaded", ErrModuleConflict, module.Name)
+	}
+	owners := s.wasmEngine.toolOwners()
+	for _, tool := range module.Tools {
+		if owner, ok := owners[tool.Name]; ok && owner != module.Name {
+			return fmt.Errorf("%w: tool %s is already provided by module %s", ErrModuleConflict, tool.Name, owner)
+		}
+	}
+
+	var changes toolChanges
+	err := s.installModule(ctx, module, OriginAdmin, &changes)
+	changes.apply(s.server)
+	return err
+}
+
+// UnloadModule unregisters the named module's tools and closes it once its
+// in-flight calls have finished. A manifest module comes back on the next
+// manifest reload.
+func (s *MCPServer) UnloadModule(ctx context.Context, name string) error {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	if _, ok := s.Module(name); !ok {
+		return fmt.Errorf("%w: %s", ErrModuleNotFound, name)
+	}
+	var changes toolChanges
+	plugin := s.removeModule(ctx, name, &changes)
+	changes.apply(s.server)
+	if plugin == nil {
+		return nil
+	}
+	return plugin.retire(ctx)
+}
+
+// ReloadModule fetches the named module again from its source and swaps it
+// in, keeping the previous plugin serving if the new one fails to load
+func (s *MCPServer) ReloadModule(ctx context.Context, name string) error {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	s.mu.RLock()
+	state, ok := s.modules[name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrModuleNotFound, name)
+	}
+	var changes toolChanges
+	err := s.installModule(ctx, state.module, state.info.Origin, &changes)
+	changes.apply(s.server)
+	return err
+}
+
+// installModule loads or replaces a module, collects its tools in changes
+// and records the outcome. Callers must hold changeMu and apply changes.
+func (s *MCPServer) installModule(ctx context.Context, module Module, origin string, changes *toolChanges) error {
+	if s.stopCtx.Err() != nil {
+		return errors.New("server is shutting down")
+	}
+
+	var previous []string
+	if plugin, ok := s.wasmEngine.Plugin(module.Name); ok {
+		previous = plugin.Tools
+	}
+
+	err := s.wasmEngine.LoadModule(ctx, module)
+	if err == nil {
+		err = s.wasmEngine.collectTools(changes, module, s.unclaimedTools(module.Name, previous))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := ModuleInfo{
+		Name:    module.Name,
+		Status:  ModuleFailed,
+		Origin:  origin,
+		Source:  module.WASMPath,
+		Exports: []string{},
+		Tools:   []string{},
+	}
+	if old, ok := s.modules[module.Name]; ok {
+		info = old.info
+		info.Origin, info.Source = origin, module.WASMPath
+		info.Status = ModuleFailed
+	}
+	if plugin, ok := s.wasmEngine.Plugin(module.Name); ok {
+		loadedAt := plugin.LoadedAt
+		info.Status = ModuleLoaded
+		info.Hash = plugin.Hash
+		info.Publisher = plugin.Publisher
+		info.Exports = append([]string{}, plugin.Exports...)
+		info.Tools = append([]string{}, plugin.Tools...)
+		info.LoadedAt = &loadedAt
+	}
+	info.Required = module.Required
+	info.LastError = ""
+	if err != nil {
+		info.LastError = err.Error()
+	}
+	s.modules[module.Name] = &moduleState{module: module, info: info}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load WASM module", "module", module.Name, "error", err)
+		return fmt.Errorf("module %s: %w", module.Name, err)
+	}
+	slog.InfoContext(ctx, "Registered module tools", "module", module.Name, "tools", len(info.Tools))
+	return nil
+}
+
+// removeModule forgets a module, detaches its plugin from the engine and
+// collects its tools for removal in changes. It returns the plugin, if
+// any, for the caller to retire once changes are applied. Callers must
+// hold changeMu.
+func (s *MCPServer) removeModule(ctx context.Context, name string, changes *toolChanges) *WASMPlugin {
+	s.mu.Lock()
+	delete(s.modules, name)
+	s.mu.Unlock()
+
+	plugin, ok := s.wasmEngine.detachModule(name)
+	if !ok {
+		return nil
+	}
+	changes.remove = append(changes.remove, s.unclaimedTools(name, plugin.Tools)...)
+	slog.InfoContext(ctx, "Unloading WASM module", "module", name)
+	return plugin
+}
+
+// unclaimedTools filters out tool names another loaded module registers, so
+// that moving a tool between modules never deletes it
+func (s *MCPServer) unclaimedTools(module string, names []string) []string {
+	owners := s.wasmEngine.toolOwners()
+	var out []string
+	for _, name := range names {
+		if owner, ok := owners[name]; !ok || owner == module {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// toolNames lists the registered tools of every loaded module
+func (s *MCPServer) toolNames() []string {
+	var names []string
+	for _, module := range s.ListModules() {
+		names = append(names, module.Tools...)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,263 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// openAPIVersion is the OpenAPI release the generated document follows;
+// 3.1 uses JSON Schema 2020-12, so tool input schemas embed unchanged
+const openAPIVersion = "3.1.0"
+
+// Version is reported by the MCP handshake, the OpenAPI document and the
+// service.version of trace spans. The server binary sets it to the build
+// version that its version command prints.
+var Version = "dev"
+
+// GenerateOpenAPI builds an OpenAPI 3.1 document for the REST gateway with
+// one POST /tools/{name} operation per tool of the given modules
+func GenerateOpenAPI(modules []Module) ([]byte, error) {
+	paths := map[string]any{
+		"/tools": map[string]any{
+			"get": map[string]any{
+				"operationId": "listTools",
+				"summary":     "List the registered tools",
+				"responses": map[string]any{
+					"200": jsonResponse("Registered tool names", map[string]any{
+						"type":     TypeObject,
+						"required": []string{"tools"},
+						"properties": map[string]any{
+							"tools": map[string]any{
+								"type":  TypeArray,
+								"items": map[string]any{"type": TypeString},
+							},
+						},
+					}),
+				},
+			},
+		},
+	}
+
+	var tags []map[string]any
+	sorted := append([]Module(nil), modules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, module := range sorted {
+		tags = append(tags, map[string]any{
+			"name":        module.Name,
+			"description": fmt.Sprintf("Tools of WASM module %s", module.Name),
+		})
+		for _, tool := range module.Tools {
+			op, err := toolOperation(module, tool)
+			if err != nil {
+				return nil, fmt.Errorf("tool %s: %w", tool.Name, err)
+			}
+			paths["/tools/"+tool.Name] = map[string]any{"post": op}
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":       "DANP-Engine tools",
+			"description": "REST gateway to the WASM tools hosted by this DANP-Engine server",
+			"version":     Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"SchemaViolation": map[string]any{
+					"type":     TypeObject,
+					"required": []string{"path", "message"},
+					"properties": map[string]any{
+						"path":    map[string]any{"type": TypeString},
+						"message": map[string]any{"type": TypeString},
+					},
+				},
+				"ToolError": map[string]any{
+					"type":     TypeObject,
+					"required": []string{"code", "message"},
+					"properties": map[string]any{
+						"code": map[string]any{
+							"type": TypeString,
+							"enum": []string{
+								ErrCodeInvalidArguments, ErrCodeInvalidOutput, ErrCodeTimeout,
+								ErrCodeCancelled, ErrCodeResourceExhausted, ErrCodeBusy,
+								ErrCodeNotFound, ErrCodeForbidden, ErrCodeInternal,
+							},
+						},
+						"message": map[string]any{"type": TypeString},
+						"violations": map[string]any{
+							"type":  TypeArray,
+							"items": map[string]any{"$ref": "#/components/schemas/SchemaViolation"},
+						},
+					},
+				},
+				"ErrorResponse": map[string]any{
+					"type":     TypeObject,
+					"required": []string{"is_error", "error", "duration_ms"},
+					"properties": map[string]any{
+						"result":      map[string]any{"type": "null"},
+						"is_error":    map[string]any{"const": true},
+						"error":       map[string]any{"$ref": "#/components/schemas/ToolError"},
+						"duration_ms": map[string]any{"type": TypeInteger},
+					},
+				},
+			},
+		},
+	}
+	if len(tags) > 0 {
+		doc["tags"] = tags
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// toolOperation describes the REST call of one tool
+func toolOperation(module Module, tool Tool) (map[string]any, error) {
+	if err := checkToolInputs(tool.Inputs, ""); err != nil {
+		return nil, err
+	}
+	input, err := inputSchema(tool.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	result, err := resultSchema(tool.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	success := map[string]any{
+		"type":     TypeObject,
+		"required": []string{"result", "is_error", "duration_ms"},
+		"properties": map[string]any{
+			"result":      result,
+			"is_error":    map[string]any{"type": TypeBoolean, "description": "True when the tool reported a failure; result then holds its output"},
+			"duration_ms": map[string]any{"type": TypeInteger},
+		},
+	}
+
+	ok := jsonResponse(orDefault(tool.Outputs.Description, "Tool result"), success)
+	ok["headers"] = map[string]any{
+		ReceiptHeader: map[string]any{
+			"description": "Receipt of the call signed by the node, as base64url JSON",
+			"schema":      map[string]any{"type": TypeString},
+		},
+	}
+	responses := map[string]any{"200": ok}
+	codes := []string{ErrCodeInvalidArguments, ErrCodeNotFound, ErrCodeResourceExhausted,
+		ErrCodeInternal, ErrCodeInvalidOutput, ErrCodeBusy, ErrCodeTimeout}
+	if len(tool.AllowedPrincipals) > 0 || len(tool.Scopes) > 0 {
+		codes = append(codes, ErrCodeForbidden)
+	}
+	for _, code := range codes {
+		status := toolErrorStatus(code)
+		responses[fmt.Sprint(status)] = jsonResponse(http.StatusText(status), map[string]any{
+			"$ref": "#/components/schemas/ErrorResponse",
+		})
+	}
+
+	op := map[string]any{
+		"operationId": tool.Name,
+		"tags":        []string{module.Name},
+		"requestBody": map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": input},
+			},
+		},
+		"responses": responses,
+	}
+	if tool.Description != "" {
+		op["summary"] = tool.Description
+	}
+	return op, nil
+}
+
+// resultSchema describes the result field of a successful call, matching
+// the representation restResult picks
+func resultSchema(o ToolOutput) (any, error) {
+	if err := checkToolOutput(o); err != nil {
+		return nil, err
+	}
+	switch o.kind() {
+	case OutputJSON:
+		schema, _, err := outputSchema(o)
+		if err != nil {
+			return nil, err
+		}
+		return schema, nil
+	case OutputText:
+		schema := map[string]any{"type": TypeString}
+		if o.Description != "" {
+			schema["description"] = o.Description
+		}
+		return schema, nil
+	default:
+		return map[string]any{
+			"type":        TypeArray,
+			"description": fmt.Sprintf("MCP content blocks carrying the %s output", o.kind()),
+			"items":       map[string]any{"type": TypeObject},
+		}, nil
+	}
+}
+
+func jsonResponse(description string, schema any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schema},
+		},
+	}
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// loadedModules returns the definitions of the loaded modules, limited to
+// the tools each one actually registered
+func (s *MCPServer) loadedModules() []Module {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var modules []Module
+	for _, state := range s.modules {
+		if state.info.Status != ModuleLoaded {
+			continue
+		}
+		module := state.module
+		module.Tools = nil
+		for _, tool := range state.module.Tools {
+			for _, name := range state.info.Tools {
+				if tool.Name == name {
+					module.Tools = append(module.Tools, tool)
+				}
+			}
+		}
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// handleOpenAPI serves the OpenAPI document of the live tool set, so it
+// follows hot reloads and admin changes
+func (s *MCPServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, err := GenerateOpenAPI(s.loadedModules())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to generate OpenAPI document", "error", err)
+		http.Error(w, "Failed to generate OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// servedOpenAPI fetches /openapi.json and returns its version and the tools
+// it documents
+func servedOpenAPI(t *testing.T, s *MCPServer) (string, []string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handleOpenAPI(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: %d %s", w.Code, w.Body)
+	}
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var tools []string
+	for path := range doc.Paths {
+		if name, ok := strings.CutPrefix(path, "/tools/"); ok {
+			tools = append(tools, name)
+		}
+	}
+	slices.Sort(tools)
+	return doc.Info.Version, tools
+}
+
+func TestOpenAPIFollowsToolSet(t *testing.T) {
+	dir := t.TempDir()
+	testModuleFiles(t, dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	writeManifest(t, path, loopManifest("1s")+hogManifestModule)
+	s := newManifestServer(t, path)
+
+	version, tools := servedOpenAPI(t, s)
+	if version != Version {
+		t.Errorf("document version %q, want the build version %q", version, Version)
+	}
+	if want := registeredTools(s); !slices.Equal(tools, want) {
+		t.Errorf("document covers %v, want every registered tool %v", tools, want)
+	}
+
+	if err := s.LoadModule(context.Background(), sayHelloModule(Tool{})); err != nil {
+		t.Fatal(err)
+	}
+	if _, tools := servedOpenAPI(t, s); !slices.Contains(tools, "say_hello") {
+		t.Errorf("document covers %v after an admin load, want say_hello", tools)
+	}
+
+	writeManifest(t, path, loopManifest("1s"))
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"loop", "ok", "say_hello"}
+	if _, tools := servedOpenAPI(t, s); !slices.Equal(tools, want) {
+		t.Errorf("document covers %v after a reload, want %v", tools, want)
+	}
+}
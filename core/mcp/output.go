@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Supported ToolOutput types
+const (
+	OutputText         = "text"
+	OutputJSON         = "json"
+	OutputImage        = "image"
+	OutputAudio        = "audio"
+	OutputResourceLink = "resource_link"
+)
+
+// kind normalizes the manifest output type, accepting the legacy aliases
+// "string" for text and "object" for json
+func (o ToolOutput) kind() string {
+	switch strings.ToLower(o.Type) {
+	case "", "string", OutputText:
+		return OutputText
+	case "object", OutputJSON:
+		return OutputJSON
+	default:
+		return strings.ToLower(o.Type)
+	}
+}
+
+// checkToolOutput verifies that a manifest output definition is usable
+func checkToolOutput(o ToolOutput) error {
+	switch o.kind() {
+	case OutputText, OutputResourceLink:
+	case OutputJSON:
+		if o.Schema != nil {
+			if t, ok := o.Schema["type"]; ok && t != TypeObject {
+				return fmt.Errorf("json output schema must have type object, got %v", t)
+			}
+		}
+	case OutputImage, OutputAudio:
+		if o.MimeType == "" {
+			return fmt.Errorf("%s output requires mime_type", o.kind())
+		}
+		if !strings.HasPrefix(o.MimeType, o.kind()+"/") {
+			return fmt.Errorf("mime_type %q does not match %s output", o.MimeType, o.kind())
+		}
+	default:
+		return fmt.Errorf("unsupported output type %q", o.Type)
+	}
+	return nil
+}
+
+// outputSchema returns the schema advertised as the tool's outputSchema.
+// Only JSON outputs carry one; a missing schema defaults to a bare object.
+func outputSchema(o ToolOutput) (json.RawMessage, bool, error) {
+	if o.kind() != OutputJSON {
+		return nil, false, nil
+	}
+
+	schema := map[string]any{"type": TypeObject}
+	for k, v := range o.Schema {
+		schema[k] = v
+	}
+	if o.Description != "" {
+		if _, ok := schema["description"]; !ok {
+			schema["description"] = o.Description
+		}
+	}
+
+	data, err := json.Marshal(normalizeJSON(schema))
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// buildResult maps raw WASM output onto MCP content according to the tool's output type
+func buildResult(tool Tool, output []byte) (*mcp.CallToolResult, error) {
+	o := tool.Outputs
+	switch o.kind() {
+	case OutputJSON:
+		var structured map[string]any
+		if err := json.Unmarshal(output, &structured); err != nil {
+			return nil, newToolError(ErrCodeInvalidOutput, "%s returned invalid JSON object: %v", tool.Name, err)
+		}
+		return mcp.NewToolResultStructured(structured, string(output)), nil
+	case OutputImage:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewImageContent(base64.StdEncoding.EncodeToString(output), o.MimeType),
+			},
+		}, nil
+	case OutputAudio:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewAudioContent(base64.StdEncoding.EncodeToString(output), o.MimeType),
+			},
+		}, nil
+	case OutputResourceLink:
+		uri := strings.TrimSpace(string(output))
+		if uri == "" {
+			return nil, newToolError(ErrCodeInvalidOutput, "%s returned an empty resource URI", tool.Name)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewResourceLink(uri, tool.Name, o.Description, o.MimeType),
+			},
+		}, nil
+	default:
+		return mcp.NewToolResultText(string(output)), nil
+	}
+}
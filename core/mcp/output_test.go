@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestOutputSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		output ToolOutput
+		want   string // empty when the tool advertises no outputSchema
+	}{
+		{"text", ToolOutput{Type: OutputText}, ""},
+		{"legacy string", ToolOutput{Type: "string"}, ""},
+		{"json without schema", ToolOutput{Type: OutputJSON}, `{"type":"object"}`},
+		{"legacy object", ToolOutput{Type: "object", Description: "a greeting"}, `{"description":"a greeting","type":"object"}`},
+		{
+			"json with schema",
+			ToolOutput{Type: OutputJSON, Schema: map[string]any{
+				"properties": map[string]any{"greeting": map[string]any{"type": "string"}},
+			}},
+			`{"properties":{"greeting":{"type":"string"}},"type":"object"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkToolOutput(tt.output); err != nil {
+				t.Fatalf("checkToolOutput: %v", err)
+			}
+			schema, ok, err := outputSchema(tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				if tt.want != "" {
+					t.Errorf("no outputSchema, want %s", tt.want)
+				}
+				return
+			}
+			if string(schema) != tt.want {
+				t.Errorf("outputSchema %s, want %s", schema, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckToolOutput(t *testing.T) {
+	for _, output := range []ToolOutput{
+		{Type: "video"},
+		{Type: OutputImage},
+		{Type: OutputImage, MimeType: "audio/wav"},
+		{Type: OutputJSON, Schema: map[string]any{"type": "array"}},
+	} {
+		if err := checkToolOutput(output); err == nil {
+			t.Errorf("%+v accepted", output)
+		}
+	}
+}
+
+func TestBuildResult(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		result, err := buildResult(Tool{Name: "t", Outputs: ToolOutput{Type: OutputJSON}}, []byte(`{"greeting":"hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		structured, _ := result.StructuredContent.(map[string]any)
+		if structured["greeting"] != "hi" {
+			t.Errorf("structured content %v", result.StructuredContent)
+		}
+		// Clients without structured content support read the text
+		if text := resultText(t, result); text != `{"greeting":"hi"}` {
+			t.Errorf("text content %q", text)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := buildResult(Tool{Name: "t", Outputs: ToolOutput{Type: OutputJSON}}, []byte(`[1]`))
+		var toolErr *ToolError
+		if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeInvalidOutput {
+			t.Errorf("error %v, want %s", err, ErrCodeInvalidOutput)
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		result, err := buildResult(Tool{Name: "t", Outputs: ToolOutput{Type: OutputImage, MimeType: "image/png"}}, []byte{0x89, 'P'})
+		if err != nil {
+			t.Fatal(err)
+		}
+		image, ok := result.Content[0].(mcp.ImageContent)
+		if !ok || image.MIMEType != "image/png" || image.Data != base64.StdEncoding.EncodeToString([]byte{0x89, 'P'}) {
+			t.Errorf("content %+v, want a base64 png", result.Content[0])
+		}
+	})
+
+	t.Run("resource link", func(t *testing.T) {
+		result, err := buildResult(Tool{Name: "t", Outputs: ToolOutput{Type: OutputResourceLink}}, []byte(" ipfs://bafy\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		link, ok := result.Content[0].(mcp.ResourceLink)
+		if !ok || link.URI != "ipfs://bafy" {
+			t.Errorf("content %+v, want a link to ipfs://bafy", result.Content[0])
+		}
+		if _, err := buildResult(Tool{Name: "t", Outputs: ToolOutput{Type: OutputResourceLink}}, []byte("  ")); err == nil {
+			t.Error("empty resource URI accepted")
+		}
+	})
+}
+
+func TestGuestErrorIsToolResult(t *testing.T) {
+	tool := Tool{Name: "t", Outputs: ToolOutput{Type: OutputJSON}}
+
+	result := (&guestError{exitCode: 1, output: []byte(`{"reason":"bad"}`)}).result(tool)
+	if !result.IsError {
+		t.Error("guest failure not flagged with isError")
+	}
+	if structured, _ := result.StructuredContent.(map[string]any); structured["reason"] != "bad" {
+		t.Errorf("structured content %v, want the guest's output", result.StructuredContent)
+	}
+
+	// Output that does not fit the declared type falls back to the error text
+	result = (&guestError{exitCode: 2, message: "boom"}).result(tool)
+	if !result.IsError || resultText(t, result) != "module returned exit code 2: boom" {
+		t.Errorf("result %+v, want the error text", result)
+	}
+}
+
+func TestToolErrorResult(t *testing.T) {
+	toolErr := newToolError(ErrCodeInvalidArguments, "bad arguments")
+	toolErr.Violations = []SchemaViolation{{Path: "name", Message: "is required"}}
+	result := toolErr.Result()
+	if !result.IsError {
+		t.Error("tool error not flagged with isError")
+	}
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"error":{"code":"invalid_arguments","message":"bad arguments","violations":[{"message":"is required","path":"name"}]}}`
+	if string(data) != want {
+		t.Errorf("structured content %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,328 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// Pool defaults applied when a module leaves the setting unset
+const (
+	defaultIdleTimeout = 5 * time.Minute
+	minEvictInterval   = time.Second
+)
+
+// errPoolBusy is returned when no instance became free before the queue deadline
+var errPoolBusy = errors.New("all instances are busy")
+
+// idleInstance is a pooled instance waiting for its next call
+type idleInstance struct {
+	plugin   *extism.Plugin
+	lastUsed time.Time
+}
+
+// instancePool keeps a bounded set of instances of one compiled module.
+// A call holds a slot for as long as it uses an instance, so at most
+// max instances exist at any time; callers beyond that wait in the slot
+// queue until an instance is released or their wait deadline passes.
+type instancePool struct {
+	compiled     *extism.CompiledPlugin
+	slots        chan struct{}
+	minInstances int
+	idleTimeout  time.Duration
+	queueTimeout time.Duration
+	memoryPages  uint32
+
+	mu      sync.Mutex
+	idle    []idleInstance
+	size    int
+	budgets map[*extism.Plugin]*memoryBudget
+	closed  bool
+	done    chan struct{}
+
+	// refilling is set while a background refill is running
+	refilling bool
+}
+
+// newInstancePool creates a pool for a compiled module and starts its idle evictor
+func newInstancePool(compiled *extism.CompiledPlugin, module Module) *instancePool {
+	maxInstances := module.MaxInstances
+	if maxInstances <= 0 {
+		maxInstances = runtime.NumCPU()
+	}
+	minInstances := module.MinInstances
+	if minInstances > maxInstances {
+		minInstances = maxInstances
+	}
+	idleTimeout := module.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+
+	p := &instancePool{
+		compiled:     compiled,
+		slots:        make(chan struct{}, maxInstances),
+		minInstances: minInstances,
+		idleTimeout:  idleTimeout,
+		queueTimeout: module.QueueTimeout,
+		memoryPages:  module.MaxMemoryPages,
+		budgets:      make(map[*extism.Plugin]*memoryBudget),
+		done:         make(chan struct{}),
+	}
+	go p.evictLoop()
+	return p
+}
+
+// warm creates instances until the pool holds at least n of them. Each
+// instance holds a slot while it is created, like a call would, so that
+// callers arriving meanwhile wait for it instead of creating their own and
+// pushing the pool past max instances. warm stops early when every slot
+// is taken; the callers holding them create instances as they need them.
+func (p *instancePool) warm(ctx context.Context, n int) error {
+	for {
+		p.mu.Lock()
+		if p.closed || p.size >= n || p.size >= cap(p.slots) {
+			p.mu.Unlock()
+			return nil
+		}
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			p.mu.Unlock()
+			return nil
+		}
+		p.size++
+		p.mu.Unlock()
+
+		plugin, err := p.instantiate(ctx)
+		p.mu.Lock()
+		if err != nil {
+			p.size--
+			p.mu.Unlock()
+			<-p.slots
+			return err
+		}
+		if p.closed {
+			p.size--
+			delete(p.budgets, plugin)
+			p.mu.Unlock()
+			<-p.slots
+			plugin.Close(ctx)
+			return nil
+		}
+		p.idle = append(p.idle, idleInstance{plugin: plugin, lastUsed: time.Now()})
+		p.mu.Unlock()
+		<-p.slots
+	}
+}
+
+// refill tops the pool back up to minInstances in the background once
+// instances were discarded or evicted
+func (p *instancePool) refill() {
+	p.mu.Lock()
+	if p.closed || p.refilling || p.size >= p.minInstances {
+		p.mu.Unlock()
+		return
+	}
+	p.refilling = true
+	p.mu.Unlock()
+
+	go func() {
+		err := p.warm(context.Background(), p.minInstances)
+		p.mu.Lock()
+		p.refilling = false
+		closed := p.closed
+		p.mu.Unlock()
+		if err != nil && !closed {
+			slog.Warn("Failed to refill WASM instance pool", "min_instances", p.minInstances, "error", err)
+		}
+	}()
+}
+
+func (p *instancePool) instantiate(ctx context.Context) (*extism.Plugin, error) {
+	var budget *memoryBudget
+	if p.memoryPages > 0 {
+		budget = newMemoryBudget(p.memoryPages)
+		ctx = experimental.WithMemoryAllocator(ctx, budget)
+	}
+	plugin, err := p.compiled.Instance(ctx, extism.PluginInstanceConfig{
+		ModuleConfig: wazero.NewModuleConfig().WithSysWalltime(),
+	})
+	if err != nil || budget == nil {
+		return plugin, err
+	}
+	if budget.oversized.Load() {
+		plugin.Close(ctx)
+		return nil, fmt.Errorf("module needs more memory than max_memory_pages (%d)", p.memoryPages)
+	}
+	p.mu.Lock()
+	p.budgets[plugin] = budget
+	p.mu.Unlock()
+	return plugin, nil
+}
+
+// memoryBudget returns the memory budget of an instance, or nil when the
+// module has none
+func (p *instancePool) memoryBudget(plugin *extism.Plugin) *memoryBudget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.budgets[plugin]
+}
+
+// exports lists the functions exported by the module, read from an idle instance
+func (p *instancePool) exports() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range p.idle[0].plugin.Module().ExportedFunctions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// acquire takes an instance from the pool, creating one if none is idle.
+// It waits for a free slot until ctx is done or the queue timeout expires.
+func (p *instancePool) acquire(ctx context.Context) (*extism.Plugin, error) {
+	waitCtx := ctx
+	if p.queueTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, p.queueTimeout)
+		defer cancel()
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-waitCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errPoolBusy
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, errors.New("module is closed")
+	}
+	if n := len(p.idle); n > 0 {
+		inst := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return inst.plugin, nil
+	}
+	p.size++
+	p.mu.Unlock()
+
+	plugin, err := p.instantiate(context.Background())
+	if err != nil {
+		p.mu.Lock()
+		p.size--
+		p.mu.Unlock()
+		<-p.slots
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// counts reports how many instances are idle and how many are serving calls
+func (p *instancePool) counts() (idle, busy int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle), p.size - len(p.idle)
+}
+
+// release returns an instance to the pool, or closes it when discard is set
+func (p *instancePool) release(plugin *extism.Plugin, discard bool) {
+	p.mu.Lock()
+	if discard || p.closed {
+		p.size--
+		delete(p.budgets, plugin)
+		p.mu.Unlock()
+		plugin.Close(context.Background())
+		p.refill()
+	} else {
+		p.idle = append(p.idle, idleInstance{plugin: plugin, lastUsed: time.Now()})
+		p.mu.Unlock()
+	}
+	<-p.slots
+}
+
+// evictLoop periodically closes instances idle for longer than idleTimeout,
+// never shrinking the pool below minInstances
+func (p *instancePool) evictLoop() {
+	interval := p.idleTimeout / 2
+	if interval < minEvictInterval {
+		interval = minEvictInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.evictIdle(time.Now())
+		}
+	}
+}
+
+func (p *instancePool) evictIdle(now time.Time) {
+	p.mu.Lock()
+	var evicted []*extism.Plugin
+	kept := p.idle[:0]
+	for _, inst := range p.idle {
+		if p.size > p.minInstances && now.Sub(inst.lastUsed) > p.idleTimeout {
+			evicted = append(evicted, inst.plugin)
+			delete(p.budgets, inst.plugin)
+			p.size--
+			continue
+		}
+		kept = append(kept, inst)
+	}
+	p.idle = kept
+	p.mu.Unlock()
+
+	if len(evicted) > 0 {
+		slog.Debug("Evicting idle WASM instances", "instances", len(evicted))
+	}
+	for _, plugin := range evicted {
+		plugin.Close(context.Background())
+	}
+	p.refill()
+}
+
+// close shuts the pool down, closing idle instances and the compiled module
+func (p *instancePool) close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.size -= len(idle)
+	p.budgets = make(map[*extism.Plugin]*memoryBudget)
+	p.mu.Unlock()
+
+	close(p.done)
+	for _, inst := range idle {
+		inst.plugin.Close(ctx)
+	}
+	return p.compiled.Close(ctx)
+}
@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// poolSize reports how many instances the module's pool holds and how many
+// of them are idle
+func poolSize(w *WASMEngine, module string) (size, idle int) {
+	plugin, _ := w.Plugin(module)
+	pool := plugin.pool
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.size, len(pool.idle)
+}
+
+// waitPoolSize waits for the module's pool to hold want idle instances
+func waitPoolSize(t *testing.T, w *WASMEngine, module string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		size, idle := poolSize(w, module)
+		if size == want && idle == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool holds %d instances (%d idle), want %d", size, idle, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolRefillsAfterDiscard(t *testing.T) {
+	module := memoryHogModule(t, 32)
+	module.MinInstances = 2
+	module.MaxInstances = 2
+	w := newTestEngine(t, module)
+	waitPoolSize(t, w, "hog", 2)
+
+	// Exhausting the memory budget discards the instance
+	if _, err := w.CallTool(context.Background(), "hog", "grow", nil); err == nil {
+		t.Fatal("grow past the budget succeeded")
+	}
+	waitPoolSize(t, w, "hog", 2)
+}
+
+func TestPoolRefillsAfterEviction(t *testing.T) {
+	module := memoryHogModule(t, 32)
+	module.MinInstances = 1
+	module.MaxInstances = 2
+	w := newTestEngine(t, module)
+
+	hog, _ := w.Plugin("hog")
+	pool := hog.pool
+
+	// Drop below the minimum the way a discard would, then let eviction run
+	pool.mu.Lock()
+	plugin := pool.idle[0].plugin
+	pool.idle = nil
+	pool.size = 0
+	delete(pool.budgets, plugin)
+	pool.mu.Unlock()
+	plugin.Close(context.Background())
+
+	pool.evictIdle(time.Now())
+	waitPoolSize(t, w, "hog", 1)
+}
+
+// slowStartWASM exports f, which returns 0. Its start function counts to
+// 2^22, so creating an instance takes a while.
+var slowStartWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: () -> (), () -> i32
+	0x01, 0x08, 0x02, 0x60, 0x00, 0x00, 0x60, 0x00, 0x01, 0x7f,
+	// functions: start, f
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// exports: f
+	0x07, 0x05, 0x01, 0x01, 'f', 0x00, 0x01,
+	// start: start
+	0x08, 0x01, 0x00,
+	// code
+	0x0a, 0x1d, 0x02,
+	// start: loop { br_if (local.tee 0 (local.get 0 + 1)) != 2^22 }
+	0x16, 0x01, 0x01, 0x7f,
+	0x03, 0x40, 0x20, 0x00, 0x41, 0x01, 0x6a, 0x22, 0x00,
+	0x41, 0x80, 0x80, 0x80, 0x02, 0x47, 0x0d, 0x00, 0x0b,
+	0x0b,
+	// f: return 0
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+}
+
+func TestPoolDiscardDuringConcurrentAcquires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.wasm")
+	if err := os.WriteFile(path, slowStartWASM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestEngine(t, Module{
+		Name:         "slow",
+		WASMPath:     "file://" + path,
+		MinInstances: 2,
+		MaxInstances: 2,
+		Tools:        []Tool{{Name: "f"}},
+	})
+	waitPoolSize(t, w, "slow", 2)
+	slow, _ := w.Plugin("slow")
+	pool := slow.pool
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	largest := 0
+	observe := func() {
+		pool.mu.Lock()
+		size := pool.size
+		pool.mu.Unlock()
+		mu.Lock()
+		largest = max(largest, size)
+		mu.Unlock()
+	}
+
+	for range 5 {
+		// Discarding starts a background refill that races the acquires
+		instance, err := pool.acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.release(instance, true)
+		// Acquire while the refill is creating its instance
+		for {
+			pool.mu.Lock()
+			size := pool.size
+			pool.mu.Unlock()
+			if size == 2 {
+				break
+			}
+			runtime.Gosched()
+		}
+
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				instance, err := pool.acquire(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				observe()
+				time.Sleep(time.Millisecond)
+				observe()
+				pool.release(instance, false)
+			}()
+		}
+		wg.Wait()
+		observe()
+	}
+	if largest > 2 {
+		t.Errorf("pool grew to %d instances, past max_instances 2", largest)
+	}
+	waitPoolSize(t, w, "slow", 2)
+}
@@ -0,0 +1,404 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ipfs/go-cid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ReceiptHeader carries the receipt of a REST tool call, as base64url JSON
+const ReceiptHeader = "X-DANP-Receipt"
+
+// ReceiptMetaKey is the _meta key of the receipt in an MCP tool result
+const ReceiptMetaKey = "danp/receipt"
+
+// receiptHashPrefix names the hash of the input and output digests
+const receiptHashPrefix = "sha256:"
+
+// Receipt is a node's signed statement that a module produced an output
+// from an input. ModuleSHA256 is the module's ModuleContentHash.
+// InputHash is the SHA-256 of the call arguments as
+// RFC 8785 canonical JSON, OutputHash the SHA-256 of the bytes the
+// module returned: the text of text and json results and the decoded data
+// of image and audio results. Signature is an EIP-191 signature of
+// Message by the Node address.
+type Receipt struct {
+	Module       string         `json:"module"`
+	ModuleCID    string         `json:"module_cid,omitempty"`
+	ModuleSHA256 string         `json:"module_sha256"`
+	Tool         string         `json:"tool"`
+	InputHash    string         `json:"input_hash"`
+	OutputHash   string         `json:"output_hash"`
+	Timestamp    time.Time      `json:"timestamp"`
+	Node         common.Address `json:"node"`
+	Signature    string         `json:"signature"`
+}
+
+// Message renders the fields covered by the signature in the text form
+// that is signed
+func (r *Receipt) Message() []byte {
+	var b strings.Builder
+	b.WriteString("DANP execution receipt\n")
+	fmt.Fprintf(&b, "Module: %s\n", r.Module)
+	fmt.Fprintf(&b, "Module CID: %s\n", r.ModuleCID)
+	fmt.Fprintf(&b, "Module SHA-256: %s\n", r.ModuleSHA256)
+	fmt.Fprintf(&b, "Tool: %s\n", r.Tool)
+	fmt.Fprintf(&b, "Input: %s\n", r.InputHash)
+	fmt.Fprintf(&b, "Output: %s\n", r.OutputHash)
+	fmt.Fprintf(&b, "Timestamp: %s\n", r.Timestamp.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "Node: %s", r.Node.Hex())
+	return []byte(b.String())
+}
+
+// Encode returns the receipt in the form of the X-DANP-Receipt header
+func (r *Receipt) Encode() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ParseReceipt reads a receipt given as JSON or in the base64url form of
+// the X-DANP-Receipt header
+func ParseReceipt(data []byte) (*Receipt, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, "{") {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+		if err != nil {
+			return nil, fmt.Errorf("receipt is neither JSON nor base64url: %w", err)
+		}
+		text = string(decoded)
+	}
+	var r Receipt
+	if err := json.Unmarshal([]byte(text), &r); err != nil {
+		return nil, fmt.Errorf("invalid receipt: %w", err)
+	}
+	return &r, nil
+}
+
+// ReceiptFromResult returns the receipt in the _meta of an MCP tool result
+func ReceiptFromResult(result *mcp.CallToolResult) (*Receipt, bool) {
+	if result == nil || result.Meta == nil {
+		return nil, false
+	}
+	value, ok := result.Meta.AdditionalFields[ReceiptMetaKey]
+	if !ok {
+		return nil, false
+	}
+	if r, ok := value.(*Receipt); ok {
+		return r, true
+	}
+	// Results decoded by a client carry the receipt as a JSON object
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	r, err := ParseReceipt(data)
+	return r, err == nil
+}
+
+// HashArguments returns the input hash of a receipt for call arguments: the
+// SHA-256 of their RFC 8785 (JCS) canonical JSON. Keys are sorted by UTF-16
+// code units, strings are escaped minimally, with no HTML escaping, and
+// numbers are written as the shortest form of their IEEE 754 double. The
+// server receives MCP arguments as doubles, so a verifier that decodes
+// numbers exactly, as json.Number, still arrives at the same hash; an
+// integer beyond 2^53 is hashed as the double the module was given.
+func HashArguments(args map[string]any) (string, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	data, err := appendCanonicalJSON(nil, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode arguments: %w", err)
+	}
+	return hashBytes(data), nil
+}
+
+// appendCanonicalJSON appends the RFC 8785 encoding of a JSON value.
+// Values of other Go types are first round-tripped through encoding/json.
+func appendCanonicalJSON(buf []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case string:
+		return appendCanonicalString(buf, v)
+	case float64:
+		return appendCanonicalNumber(buf, v)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", v, err)
+		}
+		return appendCanonicalNumber(buf, f)
+	case []any:
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = appendCanonicalJSON(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+		buf = append(buf, '{')
+		for i, key := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = appendCanonicalString(buf, key); err != nil {
+				return nil, err
+			}
+			buf = append(buf, ':')
+			if buf, err = appendCanonicalJSON(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return appendCanonicalJSON(buf, decoded)
+}
+
+// appendCanonicalString escapes only quotes, backslashes and control
+// characters, using the short escapes where JSON has them
+func appendCanonicalString(buf []byte, s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("string %q is not valid UTF-8", s)
+	}
+	buf = append(buf, '"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf = append(buf, '\\', byte(r))
+		case '\b':
+			buf = append(buf, `\b`...)
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		default:
+			if r < 0x20 {
+				buf = fmt.Appendf(buf, `\u%04x`, r)
+			} else {
+				buf = utf8.AppendRune(buf, r)
+			}
+		}
+	}
+	return append(buf, '"'), nil
+}
+
+// appendCanonicalNumber writes a double the way ECMAScript's
+// Number.prototype.toString does
+func appendCanonicalNumber(buf []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("number %v has no JSON form", f)
+	}
+	if f == 0 {
+		return append(buf, '0'), nil
+	}
+	if f < 0 {
+		buf = append(buf, '-')
+		f = -f
+	}
+
+	// The shortest digits that round-trip, and the decimal exponent n such
+	// that f = 0.digits × 10^n
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, _ := strconv.Atoi(exp)
+	n, k := e+1, len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		buf = append(buf, digits...)
+		buf = append(buf, strings.Repeat("0", n-k)...)
+	case 0 < n && n <= 21:
+		buf = append(buf, digits[:n]...)
+		buf = append(buf, '.')
+		buf = append(buf, digits[n:]...)
+	case -6 < n && n <= 0:
+		buf = append(buf, "0."...)
+		buf = append(buf, strings.Repeat("0", -n)...)
+		buf = append(buf, digits...)
+	default:
+		buf = append(buf, digits[0])
+		if k > 1 {
+			buf = append(buf, '.')
+			buf = append(buf, digits[1:]...)
+		}
+		buf = append(buf, 'e')
+		if n-1 > 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(n-1), 10)
+	}
+	return buf, nil
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785 sorts
+// object keys
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// HashOutput returns the output hash of a receipt for module output
+func HashOutput(output []byte) string {
+	return hashBytes(output)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return receiptHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// SignReceipt stamps r with the wallet's address and the current time and
+// signs it
+func (w *Wallet) SignReceipt(r *Receipt) error {
+	r.Node = w.Address
+	r.Timestamp = time.Now().UTC()
+	signature, err := w.SignMessage(r.Message())
+	if err != nil {
+		return err
+	}
+	r.Signature = hexutil.Encode(signature)
+	return nil
+}
+
+// VerifyReceipt checks that the receipt was signed by its Node address
+func VerifyReceipt(r *Receipt) error {
+	signature, err := hexutil.Decode(r.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	signer, err := RecoverMessageSigner(r.Message(), signature)
+	if err != nil {
+		return err
+	}
+	if signer != r.Node {
+		return fmt.Errorf("receipt is signed by %s, not by node %s", signer.Hex(), r.Node.Hex())
+	}
+	return nil
+}
+
+// CheckCall reports whether the receipt covers a call with args that
+// returned output
+func (r *Receipt) CheckCall(args map[string]any, output []byte) error {
+	inputHash, err := HashArguments(args)
+	if err != nil {
+		return err
+	}
+	if inputHash != r.InputHash {
+		return errors.New("arguments do not match the receipt's input hash")
+	}
+	if HashOutput(output) != r.OutputHash {
+		return errors.New("output does not match the receipt's output hash")
+	}
+	return nil
+}
+
+// moduleCID returns the CID a wasm_path loads from IPFS, or "" for local
+// files
+func moduleCID(path string) string {
+	scheme, target := parseWASMPath(path)
+	switch scheme {
+	case schemeIPFS:
+		return target
+	case "":
+		// A bare path is a CID when no such file exists, as in fetchWASM
+		if _, err := os.Stat(path); err == nil {
+			return ""
+		}
+		if _, err := cid.Decode(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// attachReceipt signs a receipt for a tool result and puts it in the
+// result's _meta. Without a signer results go out unsigned.
+func (w *WASMEngine) attachReceipt(ctx context.Context, p *WASMPlugin, tool string, args map[string]any, output []byte, result *mcp.CallToolResult) {
+	w.mu.Lock()
+	signer := w.signer
+	w.mu.Unlock()
+	if signer == nil {
+		return
+	}
+
+	inputHash, err := HashArguments(args)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to sign receipt", "module", p.module.Name, "tool", tool, "error", err)
+		return
+	}
+	receipt := &Receipt{
+		Module:       p.module.Name,
+		ModuleCID:    moduleCID(p.module.WASMPath),
+		ModuleSHA256: p.Hash,
+		Tool:         tool,
+		InputHash:    inputHash,
+		OutputHash:   HashOutput(output),
+	}
+	if err := signer.SignReceipt(receipt); err != nil {
+		slog.ErrorContext(ctx, "Failed to sign receipt", "module", p.module.Name, "tool", tool, "error", err)
+		return
+	}
+	if result.Meta == nil {
+		result.Meta = &mcp.Meta{}
+	}
+	if result.Meta.AdditionalFields == nil {
+		result.Meta.AdditionalFields = make(map[string]any)
+	}
+	result.Meta.AdditionalFields[ReceiptMetaKey] = receipt
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReceiptCoversArgumentsAsSent(t *testing.T) {
+	wallet, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newTestEngine(t, sayHelloModule(Tool{
+		Inputs: []ToolInput{
+			{Name: "name", Type: TypeString, Default: "Bob"},
+			{Name: "options", Type: TypeObject, Properties: []ToolInput{
+				{Name: "greeting", Type: TypeString, Default: "Hello"},
+			}},
+		},
+	}))
+	w.SetSigner(wallet)
+
+	options := map[string]any{}
+	args := map[string]any{"options": options}
+	result, err := w.CallTool(context.Background(), "hello", "say_hello", args)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if len(args) != 1 || len(options) != 0 {
+		t.Errorf("defaults were written into the caller's arguments: %v", args)
+	}
+
+	receipt, ok := ReceiptFromResult(result)
+	if !ok {
+		t.Fatal("result carries no receipt")
+	}
+	want, err := HashArguments(map[string]any{"options": map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.InputHash != want {
+		t.Errorf("receipt covers %s, want the arguments as sent (%s)", receipt.InputHash, want)
+	}
+}
+
+func TestHashArgumentsCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string // canonical JSON
+	}{
+		{
+			// The example of RFC 8785, section 3.2.2
+			name: "RFC 8785 example",
+			args: `{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "literals": [null, true, false]}`,
+			want: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			name: "HTML-sensitive string",
+			args: `{"html": "<a href=\"x\">&amp;</a>"}`,
+			want: `{"html":"<a href=\"x\">&amp;</a>"}`,
+		},
+		{
+			name: "large integer",
+			args: `{"id": 9007199254740993, "big": 1000000000000000000000, "under": 100000000000000000000, "small": 0.0000001, "neg": -0}`,
+			want: `{"big":1e+21,"id":9007199254740992,"neg":0,"small":1e-7,"under":100000000000000000000}`,
+		},
+		{
+			name: "keys in UTF-16 order",
+			args: `{"😀": 1, "ﬁ": 2, "b": 3, "a": {"z": 4, "y": 5}}`,
+			want: `{"a":{"y":5,"z":4},"b":3,"😀":1,"ﬁ":2}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := hashBytes([]byte(tt.want))
+
+			// Arguments decoded as doubles, as the server receives them, and
+			// exactly, as a careful verifier might, hash the same
+			var doubles map[string]any
+			if err := json.Unmarshal([]byte(tt.args), &doubles); err != nil {
+				t.Fatal(err)
+			}
+			decoder := json.NewDecoder(strings.NewReader(tt.args))
+			decoder.UseNumber()
+			var numbers map[string]any
+			if err := decoder.Decode(&numbers); err != nil {
+				t.Fatal(err)
+			}
+			for _, args := range []map[string]any{doubles, numbers} {
+				got, err := HashArguments(args)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					canonical, _ := appendCanonicalJSON(nil, args)
+					t.Errorf("arguments canonicalize to %s, want %s", canonical, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package mcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce coalesces the burst of events an editor or deploy tool
+// produces when it rewrites a file
+const reloadDebounce = 500 * time.Millisecond
+
+func (s *MCPServer) currentConfig() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Reload re-reads the manifest and applies the difference to the running
+// server: new modules are loaded, removed ones are unloaded, and modules
+// whose settings or WASM file changed are swapped for a fresh plugin once
+// their in-flight calls finish. If the manifest is invalid nothing changes.
+// Tool changes reach connected clients as notifications/tools/list_changed.
+func (s *MCPServer) Reload(ctx context.Context) error {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	if s.configPath == "" {
+		return errors.New("server was not created from a config file")
+	}
+	slog.InfoContext(ctx, "Reloading configuration", "path", s.configPath)
+
+	newConfig, err := LoadConfig(s.configPath)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reload aborted, keeping current configuration", "error", err)
+		return err
+	}
+	oldConfig := s.currentConfig()
+
+	s.mu.RLock()
+	current := make(map[string]moduleState, len(s.modules))
+	for name, state := range s.modules {
+		current[name] = *state
+	}
+	s.mu.RUnlock()
+
+	if err := checkAdminToolConflicts(newConfig, current); err != nil {
+		slog.ErrorContext(ctx, "Reload aborted, keeping current configuration", "error", err)
+		return err
+	}
+
+	if newConfig.Host != oldConfig.Host || newConfig.Port != oldConfig.Port || newConfig.MaxConnections != oldConfig.MaxConnections ||
+		!slices.Equal(newConfig.enabledTransports(), oldConfig.enabledTransports()) {
+		slog.WarnContext(ctx, "Listener settings changed; host, port, max_connections and transports take effect after a restart")
+		newConfig.Host, newConfig.Port, newConfig.MaxConnections = oldConfig.Host, oldConfig.Port, oldConfig.MaxConnections
+		newConfig.Transports = oldConfig.Transports
+	}
+	if !reflect.DeepEqual(newConfig.Tracing, oldConfig.Tracing) {
+		slog.WarnContext(ctx, "Tracing settings changed; they take effect after a restart")
+		newConfig.Tracing = oldConfig.Tracing
+	}
+	if newConfig.Logging.Level != oldConfig.Logging.Level || newConfig.Logging.Format != oldConfig.Logging.Format {
+		slog.WarnContext(ctx, "Log level and format changed; they take effect after a restart")
+	}
+	s.wasmEngine.SetConfig(newConfig)
+
+	newModules := make(map[string]bool, len(newConfig.Modules))
+	for _, module := range newConfig.Modules {
+		newModules[module.Name] = true
+	}
+
+	// Modules loaded through the admin API are not part of the manifest
+	// and survive reloads, unless the manifest now claims their name.
+	// Every tool change of the reload reaches clients as one notification.
+	var changes toolChanges
+	for name, state := range current {
+		if state.info.Origin == OriginManifest && !newModules[name] {
+			slog.InfoContext(ctx, "Module removed from manifest, unloading", "module", name)
+			if plugin := s.removeModule(ctx, name, &changes); plugin != nil {
+				go plugin.retire(context.Background())
+			}
+		}
+	}
+
+	var errs []error
+	for _, module := range newConfig.Modules {
+		state, known := current[module.Name]
+		plugin, loaded := s.wasmEngine.Plugin(module.Name)
+		if known && loaded && state.info.Origin == OriginManifest &&
+			reflect.DeepEqual(state.module, module) && !sourceChanged(module, plugin) {
+			continue
+		}
+
+		switch {
+		case known && state.info.Origin == OriginAdmin:
+			slog.InfoContext(ctx, "Manifest module replaces the module loaded through the admin API", "module", module.Name)
+		case loaded:
+			slog.InfoContext(ctx, "Module changed, swapping in a new plugin", "module", module.Name)
+		default:
+			slog.InfoContext(ctx, "Loading module", "module", module.Name)
+		}
+		if err := s.installModule(ctx, module, OriginManifest, &changes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	changes.apply(s.server)
+
+	s.mu.Lock()
+	s.config = newConfig
+	if !reflect.DeepEqual(newConfig.Auth, oldConfig.Auth) {
+		slog.InfoContext(ctx, "Authentication settings changed")
+		s.walletAuth.setConfig(newConfig.Auth.Wallet)
+		s.configAuth = newConfigAuthenticators(newConfig.Auth, s.walletAuth)
+	}
+	s.mu.Unlock()
+	go s.prefetchCIDs(s.stopCtx, newConfig)
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("reload completed with errors: %w", err)
+	}
+	slog.InfoContext(ctx, "Reload complete", "modules", len(newConfig.Modules), "tools", len(s.toolNames()))
+	return nil
+}
+
+// checkAdminToolConflicts reports manifest tools that a module loaded
+// through the admin API already provides. Admin modules survive reloads
+// unless the manifest claims their name, and two modules registering one
+// tool name would silently shadow each other.
+func checkAdminToolConflicts(config *Config, current map[string]moduleState) error {
+	manifest := make(map[string]bool, len(config.Modules))
+	for _, module := range config.Modules {
+		manifest[module.Name] = true
+	}
+	owners := make(map[string]string)
+	for name, state := range current {
+		if state.info.Origin != OriginAdmin || manifest[name] {
+			continue
+		}
+		for _, tool := range state.info.Tools {
+			owners[tool] = name
+		}
+	}
+
+	var errs []error
+	for _, module := range config.Modules {
+		for _, tool := range module.Tools {
+			if owner, ok := owners[tool.Name]; ok {
+				errs = append(errs, fmt.Errorf("%w: tool %s of module %s is already provided by module %s, loaded through the admin API",
+					ErrModuleConflict, tool.Name, module.Name, owner))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// localWASMFile returns the filesystem path of a module loaded from disk
+func localWASMFile(module Module) (string, bool) {
+	scheme, target := parseWASMPath(module.WASMPath)
+	switch scheme {
+	case schemeFile:
+		return target, true
+	case "":
+		if _, err := os.Stat(target); err == nil {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// sourceChanged reports whether a module's WASM file on disk differs from
+// the file the plugin was compiled from. IPFS content is immutable.
+func sourceChanged(module Module, plugin *WASMPlugin) bool {
+	path, ok := localWASMFile(module)
+	if !ok {
+		return false
+	}
+	file, err := readModuleFile(path)
+	if err != nil {
+		return true
+	}
+	return hex.EncodeToString(ModuleContentHash([]ModuleFile{file})) != plugin.Hash
+}
+
+// watchedFiles lists the manifest and every local WASM file as absolute paths
+func (s *MCPServer) watchedFiles() map[string]bool {
+	files := make(map[string]bool)
+	add := func(path string) {
+		if abs, err := filepath.Abs(path); err == nil {
+			files[abs] = true
+		}
+	}
+	add(s.configPath)
+	for _, module := range s.currentConfig().Modules {
+		if path, ok := localWASMFile(module); ok {
+			add(path)
+		}
+	}
+	return files
+}
+
+// Watch reloads the server whenever the manifest or a file:// WASM module
+// changes on disk, until ctx is done. Parent directories are watched rather
+// than the files themselves so that editors replacing a file by rename are
+// noticed too.
+func (s *MCPServer) Watch(ctx context.Context) error {
+	if s.configPath == "" {
+		return errors.New("server was not created from a config file")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	watchedDirs := make(map[string]bool)
+	var files map[string]bool
+	refresh := func() {
+		files = s.watchedFiles()
+		for file := range files {
+			dir := filepath.Dir(file)
+			if watchedDirs[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				slog.WarnContext(ctx, "Failed to watch directory", "path", dir, "error", err)
+				continue
+			}
+			watchedDirs[dir] = true
+		}
+	}
+	refresh()
+	slog.InfoContext(ctx, "Watching files for changes", "files", len(files))
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			path, err := filepath.Abs(event.Name)
+			if err != nil || !files[path] {
+				continue
+			}
+			slog.InfoContext(ctx, "Detected file change", "path", path)
+			debounce.Reset(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.WarnContext(ctx, "File watcher error", "error", err)
+		case <-debounce.C:
+			if err := s.Reload(ctx); err != nil {
+				slog.ErrorContext(ctx, "Reload failed", "error", err)
+			}
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// testSession is an initialized client session that records notifications
+type testSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	logLevel      mcp.LoggingLevel
+}
+
+func newTestSession(t *testing.T, s *MCPServer) *testSession {
+	t.Helper()
+	session := &testSession{id: t.Name(), notifications: make(chan mcp.JSONRPCNotification, 64)}
+	if err := s.server.RegisterSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return s.id }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+func (s *testSession) SetLogLevel(level mcp.LoggingLevel) { s.logLevel = level }
+func (s *testSession) GetLogLevel() mcp.LoggingLevel      { return s.logLevel }
+
+// listChanged drains the session and counts tools/list_changed notifications
+func (s *testSession) listChanged() int {
+	n := 0
+	for {
+		select {
+		case notification := <-s.notifications:
+			if notification.Method == mcp.MethodNotificationToolsListChanged {
+				n++
+			}
+		default:
+			return n
+		}
+	}
+}
+
+// testModuleFiles writes the loop and hog test modules into dir
+func testModuleFiles(t *testing.T, dir string) {
+	t.Helper()
+	for name, data := range map[string][]byte{"loop.wasm": loopWASM, "hog.wasm": memoryHogWASM} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeManifest writes a manifest whose modules section is modules
+func writeManifest(t *testing.T, path, modules string) {
+	t.Helper()
+	dir := filepath.Dir(path)
+	manifest := "signature_policy: off\nmodules:\n" + strings.ReplaceAll(modules, "$DIR", dir)
+	if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newManifestServer creates a server from the manifest at path, closing
+// its modules when the test ends
+func newManifestServer(t *testing.T, path string) *MCPServer {
+	t.Helper()
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServerFromConfig(config, path)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.wasmEngine.Close(ctx)
+	})
+	return s
+}
+
+const (
+	loopManifestModule = `  - name: loop
+    wasm_path: file://$DIR/loop.wasm
+    timeout: %s
+    tools: [{name: loop}, {name: ok}]
+`
+	hogManifestModule = `  - name: hog
+    wasm_path: file://$DIR/hog.wasm
+    tools: [{name: grow}, {name: trap}]
+`
+	helloManifestModule = `  - name: hello
+    wasm_path: ` + sayHelloWASM + `
+    tools: [{name: say_hello}]
+`
+)
+
+func loopManifest(timeout string) string {
+	return strings.Replace(loopManifestModule, "%s", timeout, 1)
+}
+
+// registeredTools lists the tools the MCP server serves
+func registeredTools(s *MCPServer) []string {
+	var names []string
+	for name := range s.server.ListTools() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestReloadSwapsChangedModules(t *testing.T) {
+	dir := t.TempDir()
+	testModuleFiles(t, dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	writeManifest(t, path, loopManifest("1s")+hogManifestModule)
+	s := newManifestServer(t, path)
+	session := newTestSession(t, s)
+
+	loop, _ := s.wasmEngine.Plugin("loop")
+	hog, _ := s.wasmEngine.Plugin("hog")
+
+	writeManifest(t, path, loopManifest("2s")+hogManifestModule)
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if plugin, _ := s.wasmEngine.Plugin("loop"); plugin == loop {
+		t.Error("changed module kept its plugin")
+	}
+	if plugin, _ := s.wasmEngine.Plugin("hog"); plugin != hog {
+		t.Error("unchanged module was swapped")
+	}
+	if n := session.listChanged(); n != 1 {
+		t.Errorf("reload sent %d tools/list_changed notifications, want 1", n)
+	}
+
+	// Removing one module and adding another is still one notification
+	writeManifest(t, path, loopManifest("2s")+helloManifestModule)
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if n := session.listChanged(); n != 1 {
+		t.Errorf("reload sent %d tools/list_changed notifications, want 1", n)
+	}
+	want := []string{"loop", "ok", "say_hello"}
+	if got := registeredTools(s); !slices.Equal(got, want) {
+		t.Errorf("tools %v after reload, want %v", got, want)
+	}
+}
+
+func TestReloadRejectsAdminToolConflict(t *testing.T) {
+	dir := t.TempDir()
+	testModuleFiles(t, dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	writeManifest(t, path, loopManifest("1s"))
+	s := newManifestServer(t, path)
+
+	if err := s.LoadModule(context.Background(), sayHelloModule(Tool{})); err != nil {
+		t.Fatalf("LoadModule: %v", err)
+	}
+	session := newTestSession(t, s)
+
+	// The manifest now provides say_hello under another module name
+	writeManifest(t, path, loopManifest("1s")+strings.Replace(helloManifestModule, "name: hello", "name: greeter", 1))
+	err := s.Reload(context.Background())
+	if !errors.Is(err, ErrModuleConflict) {
+		t.Fatalf("Reload: %v, want a conflict", err)
+	}
+	if _, ok := s.wasmEngine.Plugin("greeter"); ok {
+		t.Error("conflicting module was loaded")
+	}
+	if owner := s.wasmEngine.toolOwners()["say_hello"]; owner != "hello" {
+		t.Errorf("say_hello is served by %q, want the admin module", owner)
+	}
+	if n := session.listChanged(); n != 0 {
+		t.Errorf("rejected reload sent %d tools/list_changed notifications", n)
+	}
+
+	// Claiming the admin module's name replaces it instead
+	writeManifest(t, path, loopManifest("1s")+helloManifestModule)
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if info, _ := s.Module("hello"); info.Origin != OriginManifest {
+		t.Errorf("hello has origin %s, want %s", info.Origin, OriginManifest)
+	}
+}
+
+func TestReloadKeepsConfigOnInvalidManifest(t *testing.T) {
+	dir := t.TempDir()
+	testModuleFiles(t, dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	writeManifest(t, path, loopManifest("1s"))
+	s := newManifestServer(t, path)
+	loop, _ := s.wasmEngine.Plugin("loop")
+
+	writeManifest(t, path, loopManifest("1s")+"    bogus: 1\n")
+	if err := s.Reload(context.Background()); err == nil {
+		t.Fatal("invalid manifest reloaded")
+	}
+	if plugin, _ := s.wasmEngine.Plugin("loop"); plugin != loop {
+		t.Error("invalid manifest swapped a module")
+	}
+}
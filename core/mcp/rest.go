@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxToolBody bounds the size of a REST tool call body
+const maxToolBody = 4 << 20
+
+// statusClientClosedRequest reports a call the client cancelled, following
+// the nginx convention
+const statusClientClosedRequest = 499
+
+// ToolResponse is the JSON envelope returned by POST /tools/{name}.
+// Result holds the structured content of JSON outputs, the text of text
+// outputs and the MCP content list otherwise.
+type ToolResponse struct {
+	Result     any        `json:"result"`
+	IsError    bool       `json:"is_error"`
+	Error      *ToolError `json:"error,omitempty"`
+	DurationMS int64      `json:"duration_ms"`
+}
+
+// handleToolCall serves the REST gateway. The body is the JSON object of
+// tool arguments, which goes through the same validation, timeouts and
+// result mapping as an MCP tools/call. Signed results carry their receipt
+// in the X-DANP-Receipt header.
+func (s *MCPServer) handleToolCall(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	name := r.PathValue("name")
+
+	respond := func(status int, result *mcp.CallToolResult, toolErr *ToolError) {
+		resp := ToolResponse{DurationMS: time.Since(start).Milliseconds()}
+		if toolErr != nil {
+			resp.IsError = true
+			resp.Error = toolErr
+		} else {
+			resp.Result = restResult(result)
+			resp.IsError = result.IsError
+			if receipt, ok := ReceiptFromResult(result); ok {
+				if encoded, err := receipt.Encode(); err == nil {
+					w.Header().Set(ReceiptHeader, encoded)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	module, ok := s.wasmEngine.toolOwners()[name]
+	if !ok {
+		respond(http.StatusNotFound, nil, newToolError(ErrCodeNotFound, "tool %s not found", name))
+		return
+	}
+
+	args, err := decodeToolArguments(http.MaxBytesReader(w, r.Body, maxToolBody))
+	if err != nil {
+		respond(http.StatusBadRequest, nil, newToolError(ErrCodeInvalidArguments, "%v", err))
+		return
+	}
+
+	result, err := s.wasmEngine.CallTool(r.Context(), module, name, args)
+	if err != nil {
+		var toolErr *ToolError
+		switch {
+		case errors.As(err, &toolErr):
+		case errors.Is(err, errToolNotFound):
+			toolErr = newToolError(ErrCodeNotFound, "tool %s not found", name)
+		default:
+			// The detail may describe server internals, so it stays in the log
+			slog.ErrorContext(r.Context(), "REST tool call failed", "tool", name, "error", err)
+			toolErr = newToolError(ErrCodeInternal, "internal error")
+		}
+		respond(toolErrorStatus(toolErr.Code), nil, toolErr)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "REST tool call completed", "tool", name, "duration", time.Since(start))
+	respond(http.StatusOK, result, nil)
+}
+
+// decodeToolArguments reads a JSON object of tool arguments; an empty body
+// means no arguments
+func decodeToolArguments(body io.Reader) (map[string]any, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	args := map[string]any{}
+	if len(data) == 0 {
+		return args, nil
+	}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, fmt.Errorf("request body must be a JSON object of tool arguments: %w", err)
+	}
+	return args, nil
+}
+
+// restResult picks the most useful representation of a tool result
+func restResult(result *mcp.CallToolResult) any {
+	if result.StructuredContent != nil {
+		return result.StructuredContent
+	}
+	if len(result.Content) == 1 {
+		if text, ok := result.Content[0].(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return result.Content
+}
+
+// toolErrorStatus maps a tool error code onto an HTTP status
+func toolErrorStatus(code string) int {
+	switch code {
+	case ErrCodeInvalidArguments:
+		return http.StatusBadRequest
+	case ErrCodeNotFound:
+		return http.StatusNotFound
+	case ErrCodeForbidden:
+		return http.StatusForbidden
+	case ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrCodeCancelled:
+		return statusClientClosedRequest
+	case ErrCodeBusy:
+		return http.StatusServiceUnavailable
+	case ErrCodeResourceExhausted:
+		return http.StatusUnprocessableEntity
+	case ErrCodeInvalidOutput:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
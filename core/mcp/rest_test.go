@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToolErrorStatus(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{ErrCodeInvalidArguments, http.StatusBadRequest},
+		{ErrCodeForbidden, http.StatusForbidden},
+		{ErrCodeNotFound, http.StatusNotFound},
+		{ErrCodeResourceExhausted, http.StatusUnprocessableEntity},
+		{ErrCodeCancelled, statusClientClosedRequest},
+		{ErrCodeInternal, http.StatusInternalServerError},
+		{ErrCodeInvalidOutput, http.StatusBadGateway},
+		{ErrCodeBusy, http.StatusServiceUnavailable},
+		{ErrCodeTimeout, http.StatusGatewayTimeout},
+		{"unknown", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := toolErrorStatus(tt.code); got != tt.want {
+			t.Errorf("toolErrorStatus(%s) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRESTGatewayEnvelope(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hog := memoryHogModule(t, 0)
+	hog.Tools[0].Scopes = []string{"hog:grow"}
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Auth:            AuthConfig{APIKeys: []APIKeyConfig{{Principal: "ops", Hash: HashAPIKey(key)}}},
+		Modules: []Module{
+			sayHelloModule(Tool{Inputs: []ToolInput{{Name: "name", Type: "string", Required: true}}}),
+			loopModule(t, 50*time.Millisecond),
+			hog,
+		},
+	})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.wasmEngine.Close(ctx)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/tools/{name}", s.requireAuth(http.HandlerFunc(s.handleToolCall)))
+
+	tests := []struct {
+		name       string
+		tool       string
+		body       string
+		anonymous  bool
+		wantStatus int
+		wantCode   string // empty for a successful call
+	}{
+		{name: "success", tool: "say_hello", body: `{"name": "Bob"}`, wantStatus: http.StatusOK},
+		{name: "malformed body", tool: "say_hello", body: `[1]`, wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidArguments},
+		{name: "schema violation", tool: "say_hello", body: `{}`, wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidArguments},
+		{name: "no credentials", tool: "say_hello", body: `{"name": "Bob"}`, anonymous: true, wantStatus: http.StatusUnauthorized},
+		{name: "missing scope", tool: "grow", wantStatus: http.StatusForbidden, wantCode: ErrCodeForbidden},
+		{name: "unknown tool", tool: "nope", wantStatus: http.StatusNotFound, wantCode: ErrCodeNotFound},
+		{name: "timeout", tool: "loop", wantStatus: http.StatusGatewayTimeout, wantCode: ErrCodeTimeout},
+		{name: "trap", tool: "trap", wantStatus: http.StatusInternalServerError, wantCode: ErrCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/tools/"+tt.tool, strings.NewReader(tt.body))
+			if !tt.anonymous {
+				r.Header.Set("X-API-Key", key)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST /tools/%s: %d %s, want %d", tt.tool, w.Code, w.Body, tt.wantStatus)
+			}
+			if tt.anonymous {
+				return
+			}
+
+			var resp ToolResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not an envelope: %v\n%s", err, w.Body)
+			}
+			if tt.wantCode == "" {
+				if text, _ := resp.Result.(string); resp.IsError || resp.Error != nil || !strings.Contains(text, "Bob") {
+					t.Errorf("envelope %+v", resp)
+				}
+				return
+			}
+			if !resp.IsError || resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Fatalf("envelope %s, want error code %s", w.Body, tt.wantCode)
+			}
+			if tt.wantCode == ErrCodeInternal && resp.Error.Message != "internal error" {
+				t.Errorf("internal error message %q leaks the underlying error", resp.Error.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Supported ToolInput types, mirroring the JSON Schema primitive types
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+)
+
+// SchemaViolation describes a single argument that failed validation
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// String renders the violation as "path: message"
+func (v SchemaViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// checkToolInputs verifies that manifest input definitions can be turned into a schema
+func checkToolInputs(inputs []ToolInput, prefix string) error {
+	seen := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		path := joinPath(prefix, input.Name)
+		if input.Name == "" {
+			return fmt.Errorf("%s: input name is required", prefix)
+		}
+		if seen[input.Name] {
+			return fmt.Errorf("%s: duplicate input name", path)
+		}
+		seen[input.Name] = true
+		if err := checkToolInput(input, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkToolInput(input ToolInput, path string) error {
+	switch input.Type {
+	case "", TypeString, TypeNumber, TypeInteger, TypeBoolean:
+	case TypeObject:
+		if err := checkToolInputs(input.Properties, path); err != nil {
+			return err
+		}
+	case TypeArray:
+		if input.Items != nil {
+			if err := checkToolInput(*input.Items, path+"[]"); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported type %q", path, input.Type)
+	}
+
+	if len(input.Properties) > 0 && input.Type != TypeObject {
+		return fmt.Errorf("%s: properties are only allowed on object inputs", path)
+	}
+	if input.Items != nil && input.Type != TypeArray {
+		return fmt.Errorf("%s: items are only allowed on array inputs", path)
+	}
+	if input.Pattern != "" {
+		if _, err := regexp.Compile(input.Pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+	}
+	if input.Minimum != nil && input.Maximum != nil && *input.Minimum > *input.Maximum {
+		return fmt.Errorf("%s: minimum is greater than maximum", path)
+	}
+	if input.Default != nil {
+		var violations []SchemaViolation
+		validateValue(path, input, compilePatterns([]ToolInput{input}), normalizeJSON(input.Default), &violations)
+		if len(violations) > 0 {
+			return fmt.Errorf("invalid default: %s", violations[0])
+		}
+	}
+	return nil
+}
+
+// inputPatterns holds the compiled pattern of every input of a tool, keyed
+// by the pattern's source
+type inputPatterns map[string]*regexp.Regexp
+
+// compilePatterns compiles the patterns of inputs and their nested inputs
+// once, so calls do not recompile them. Invalid patterns are left out;
+// checkToolInputs reports them at load time.
+func compilePatterns(inputs []ToolInput) inputPatterns {
+	patterns := make(inputPatterns)
+	var walk func(in ToolInput)
+	walk = func(in ToolInput) {
+		if in.Pattern != "" {
+			if re, err := regexp.Compile(in.Pattern); err == nil {
+				patterns[in.Pattern] = re
+			}
+		}
+		for _, property := range in.Properties {
+			walk(property)
+		}
+		if in.Items != nil {
+			walk(*in.Items)
+		}
+	}
+	for _, input := range inputs {
+		walk(input)
+	}
+	return patterns
+}
+
+// inputSchema builds the JSON Schema advertised as a tool's inputSchema
+func inputSchema(inputs []ToolInput) (json.RawMessage, error) {
+	return json.Marshal(objectSchema(inputs))
+}
+
+func objectSchema(inputs []ToolInput) map[string]any {
+	properties := make(map[string]any, len(inputs))
+	required := []string{}
+	for _, input := range inputs {
+		properties[input.Name] = input.schema()
+		if input.Required {
+			required = append(required, input.Name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":       TypeObject,
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schema returns the JSON Schema fragment describing a single input
+func (in ToolInput) schema() map[string]any {
+	var schema map[string]any
+	if in.Type == TypeObject {
+		schema = objectSchema(in.Properties)
+	} else {
+		schema = map[string]any{}
+		if in.Type != "" {
+			schema["type"] = in.Type
+		}
+	}
+
+	if in.Description != "" {
+		schema["description"] = in.Description
+	}
+	if in.Items != nil {
+		schema["items"] = in.Items.schema()
+	}
+	if len(in.Enum) > 0 {
+		schema["enum"] = normalizeJSON(in.Enum)
+	}
+	if in.Default != nil {
+		schema["default"] = normalizeJSON(in.Default)
+	}
+	if in.Minimum != nil {
+		schema["minimum"] = *in.Minimum
+	}
+	if in.Maximum != nil {
+		schema["maximum"] = *in.Maximum
+	}
+	if in.MinLength != nil {
+		schema["minLength"] = *in.MinLength
+	}
+	if in.MaxLength != nil {
+		schema["maxLength"] = *in.MaxLength
+	}
+	if in.MinItems != nil {
+		schema["minItems"] = *in.MinItems
+	}
+	if in.MaxItems != nil {
+		schema["maxItems"] = *in.MaxItems
+	}
+	if in.Pattern != "" {
+		schema["pattern"] = in.Pattern
+	}
+	return schema
+}
+
+// validateArguments checks call arguments against the tool's input definitions
+// and returns every violation found, sorted by path. patterns holds the
+// compiled patterns of inputs.
+func validateArguments(inputs []ToolInput, patterns inputPatterns, args map[string]any) []SchemaViolation {
+	var violations []SchemaViolation
+	validateObject("", inputs, patterns, args, &violations)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations
+}
+
+func validateObject(prefix string, inputs []ToolInput, patterns inputPatterns, obj map[string]any, out *[]SchemaViolation) {
+	for _, input := range inputs {
+		path := joinPath(prefix, input.Name)
+		value, ok := obj[input.Name]
+		if !ok {
+			if input.Required {
+				*out = append(*out, SchemaViolation{Path: path, Message: "is required"})
+			}
+			continue
+		}
+		validateValue(path, input, patterns, value, out)
+	}
+}
+
+func validateValue(path string, in ToolInput, patterns inputPatterns, value any, out *[]SchemaViolation) {
+	fail := func(format string, args ...any) {
+		*out = append(*out, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch in.Type {
+	case TypeString:
+		s, ok := value.(string)
+		if !ok {
+			fail("expected string, got %s", jsonType(value))
+			return
+		}
+		length := utf8.RuneCountInString(s)
+		if in.MinLength != nil && length < *in.MinLength {
+			fail("length %d is less than minLength %d", length, *in.MinLength)
+		}
+		if in.MaxLength != nil && length > *in.MaxLength {
+			fail("length %d is greater than maxLength %d", length, *in.MaxLength)
+		}
+		if in.Pattern != "" {
+			if re := patterns[in.Pattern]; re != nil && !re.MatchString(s) {
+				fail("does not match pattern %q", in.Pattern)
+			}
+		}
+	case TypeNumber, TypeInteger:
+		n, ok := toFloat(value)
+		if !ok {
+			fail("expected %s, got %s", in.Type, jsonType(value))
+			return
+		}
+		if in.Type == TypeInteger && n != math.Trunc(n) {
+			fail("expected integer, got %v", n)
+		}
+		if in.Minimum != nil && n < *in.Minimum {
+			fail("%v is less than minimum %v", n, *in.Minimum)
+		}
+		if in.Maximum != nil && n > *in.Maximum {
+			fail("%v is greater than maximum %v", n, *in.Maximum)
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			fail("expected boolean, got %s", jsonType(value))
+			return
+		}
+	case TypeObject:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			fail("expected object, got %s", jsonType(value))
+			return
+		}
+		validateObject(path, in.Properties, patterns, obj, out)
+	case TypeArray:
+		items, ok := value.([]any)
+		if !ok {
+			fail("expected array, got %s", jsonType(value))
+			return
+		}
+		if in.MinItems != nil && len(items) < *in.MinItems {
+			fail("has %d items, fewer than minItems %d", len(items), *in.MinItems)
+		}
+		if in.MaxItems != nil && len(items) > *in.MaxItems {
+			fail("has %d items, more than maxItems %d", len(items), *in.MaxItems)
+		}
+		if in.Items != nil {
+			for i, item := range items {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), *in.Items, patterns, item, out)
+			}
+		}
+	}
+
+	if len(in.Enum) > 0 && !enumContains(in.Enum, value) {
+		fail("must be one of %s", mustMarshal(normalizeJSON(in.Enum)))
+	}
+}
+
+// applyDefaults returns a copy of args with manifest defaults filled in
+// for the arguments the caller omitted. args itself is left as the caller
+// sent it, nested objects included.
+func applyDefaults(inputs []ToolInput, args map[string]any) map[string]any {
+	out := make(map[string]any, len(args))
+	maps.Copy(out, args)
+	for _, input := range inputs {
+		value, ok := out[input.Name]
+		if !ok {
+			if input.Default != nil {
+				out[input.Name] = normalizeJSON(input.Default)
+			}
+			continue
+		}
+		if input.Type == TypeObject {
+			if obj, ok := value.(map[string]any); ok {
+				out[input.Name] = applyDefaults(input.Properties, obj)
+			}
+		}
+	}
+	return out
+}
+
+func enumContains(enum []any, value any) bool {
+	encoded := mustMarshal(value)
+	for _, candidate := range enum {
+		if bytes.Equal(mustMarshal(normalizeJSON(candidate)), encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeJSON round-trips a YAML-decoded value through JSON so it compares
+// equal to values decoded from a JSON-RPC request
+func normalizeJSON(value any) any {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return value
+	}
+	return out
+}
+
+func mustMarshal(value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return []byte(fmt.Sprintf("%v", value))
+	}
+	return data
+}
+
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return TypeString
+	case bool:
+		return TypeBoolean
+	case float64, float32, int, int64, json.Number:
+		return TypeNumber
+	case map[string]any:
+		return TypeObject
+	case []any:
+		return TypeArray
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []ToolInput
+		args   map[string]any
+		want   []string // violation paths, nil when the arguments are valid
+	}{
+		{
+			name:   "missing required",
+			inputs: []ToolInput{{Name: "name", Type: TypeString, Required: true}},
+			args:   map[string]any{},
+			want:   []string{"name"},
+		},
+		{
+			name:   "missing optional",
+			inputs: []ToolInput{{Name: "name", Type: TypeString}},
+			args:   map[string]any{},
+		},
+		{
+			name: "type mismatches",
+			inputs: []ToolInput{
+				{Name: "s", Type: TypeString},
+				{Name: "n", Type: TypeNumber},
+				{Name: "i", Type: TypeInteger},
+				{Name: "b", Type: TypeBoolean},
+				{Name: "o", Type: TypeObject},
+				{Name: "a", Type: TypeArray},
+			},
+			args: map[string]any{"s": 1.0, "n": "1", "i": true, "b": "true", "o": []any{}, "a": map[string]any{}},
+			want: []string{"a", "b", "i", "n", "o", "s"},
+		},
+		{
+			name: "matching types",
+			inputs: []ToolInput{
+				{Name: "s", Type: TypeString},
+				{Name: "n", Type: TypeNumber},
+				{Name: "i", Type: TypeInteger},
+				{Name: "b", Type: TypeBoolean},
+				{Name: "o", Type: TypeObject},
+				{Name: "a", Type: TypeArray},
+			},
+			args: map[string]any{"s": "x", "n": 1.5, "i": 2.0, "b": false, "o": map[string]any{}, "a": []any{}},
+		},
+		{
+			name: "nested object path",
+			inputs: []ToolInput{{Name: "a", Type: TypeObject, Properties: []ToolInput{
+				{Name: "b", Type: TypeInteger, Required: true},
+				{Name: "c", Type: TypeString},
+			}}},
+			args: map[string]any{"a": map[string]any{"c": 3.0}},
+			want: []string{"a.b", "a.c"},
+		},
+		{
+			name:   "array item path",
+			inputs: []ToolInput{{Name: "a", Type: TypeArray, Items: &ToolInput{Type: TypeString}}},
+			args:   map[string]any{"a": []any{"x", 1.0, "z"}},
+			want:   []string{"a[1]"},
+		},
+		{
+			name: "object in array",
+			inputs: []ToolInput{{Name: "a", Type: TypeArray, Items: &ToolInput{Type: TypeObject, Properties: []ToolInput{
+				{Name: "b", Type: TypeString, Required: true},
+			}}}},
+			args: map[string]any{"a": []any{map[string]any{"b": "x"}, map[string]any{}}},
+			want: []string{"a[1].b"},
+		},
+		{
+			name:   "enum",
+			inputs: []ToolInput{{Name: "color", Type: TypeString, Enum: []any{"red", "green"}}},
+			args:   map[string]any{"color": "blue"},
+			want:   []string{"color"},
+		},
+		{
+			name:   "enum match",
+			inputs: []ToolInput{{Name: "size", Type: TypeInteger, Enum: []any{1, 2}}},
+			args:   map[string]any{"size": 2.0},
+		},
+		{
+			name:   "pattern",
+			inputs: []ToolInput{{Name: "id", Type: TypeString, Pattern: `^[a-z]+$`}},
+			args:   map[string]any{"id": "ABC"},
+			want:   []string{"id"},
+		},
+		{
+			name:   "pattern match",
+			inputs: []ToolInput{{Name: "id", Type: TypeString, Pattern: `^[a-z]+$`}},
+			args:   map[string]any{"id": "abc"},
+		},
+		{
+			name: "min and max length",
+			inputs: []ToolInput{
+				{Name: "short", Type: TypeString, MinLength: ptr(3)},
+				{Name: "long", Type: TypeString, MaxLength: ptr(3)},
+				{Name: "runes", Type: TypeString, MaxLength: ptr(3)},
+			},
+			args: map[string]any{"short": "ab", "long": "abcd", "runes": "äöü"},
+			want: []string{"long", "short"},
+		},
+		{
+			name: "min and max items",
+			inputs: []ToolInput{
+				{Name: "few", Type: TypeArray, MinItems: ptr(2)},
+				{Name: "many", Type: TypeArray, MaxItems: ptr(1)},
+			},
+			args: map[string]any{"few": []any{1.0}, "many": []any{1.0, 2.0}},
+			want: []string{"few", "many"},
+		},
+		{
+			name:   "fractional integer",
+			inputs: []ToolInput{{Name: "count", Type: TypeInteger}},
+			args:   map[string]any{"count": 1.5},
+			want:   []string{"count"},
+		},
+		{
+			name:   "fractional number",
+			inputs: []ToolInput{{Name: "ratio", Type: TypeNumber}},
+			args:   map[string]any{"ratio": 1.5},
+		},
+		{
+			name: "minimum and maximum",
+			inputs: []ToolInput{
+				{Name: "low", Type: TypeNumber, Minimum: ptr(1.0)},
+				{Name: "high", Type: TypeNumber, Maximum: ptr(1.0)},
+			},
+			args: map[string]any{"low": 0.5, "high": 1.5},
+			want: []string{"high", "low"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkToolInputs(tt.inputs, ""); err != nil {
+				t.Fatalf("checkToolInputs: %v", err)
+			}
+			var got []string
+			for _, v := range validateArguments(tt.inputs, compilePatterns(tt.inputs), tt.args) {
+				got = append(got, v.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompilePatternsCoversNestedInputs(t *testing.T) {
+	inputs := []ToolInput{
+		{Name: "top", Type: TypeString, Pattern: `^a`},
+		{Name: "obj", Type: TypeObject, Properties: []ToolInput{{Name: "inner", Type: TypeString, Pattern: `^b`}}},
+		{Name: "list", Type: TypeArray, Items: &ToolInput{Type: TypeString, Pattern: `^c`}},
+	}
+	patterns := compilePatterns(inputs)
+	for _, source := range []string{`^a`, `^b`, `^c`} {
+		if patterns[source] == nil {
+			t.Errorf("pattern %q not compiled", source)
+		}
+	}
+}
+
+func TestCheckToolInputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input ToolInput
+	}{
+		{"default of the wrong type", ToolInput{Name: "n", Type: TypeInteger, Default: "one"}},
+		{"default outside the enum", ToolInput{Name: "c", Type: TypeString, Enum: []any{"red"}, Default: "blue"}},
+		{"default not matching the pattern", ToolInput{Name: "id", Type: TypeString, Pattern: `^[a-z]+$`, Default: "ABC"}},
+		{"invalid pattern", ToolInput{Name: "id", Type: TypeString, Pattern: `(`}},
+		{"unsupported type", ToolInput{Name: "x", Type: "date"}},
+		{"minimum above maximum", ToolInput{Name: "n", Type: TypeNumber, Minimum: ptr(2.0), Maximum: ptr(1.0)}},
+		{"properties on a string", ToolInput{Name: "s", Type: TypeString, Properties: []ToolInput{{Name: "x"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkToolInputs([]ToolInput{tt.input}, ""); err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+func TestBadDefaultRejectedAtLoad(t *testing.T) {
+	w := NewWASMEngine(&Config{SignaturePolicy: SignaturePolicyOff})
+	defer w.Close(context.Background())
+	module := sayHelloModule(Tool{Inputs: []ToolInput{{Name: "count", Type: TypeInteger, Default: 1.5}}})
+	if err := w.LoadModule(context.Background(), module); err == nil {
+		t.Error("module whose tool has an invalid default loaded")
+	}
+}
+
+func TestInvalidArgumentsNeverReachTheModule(t *testing.T) {
+	w := newTestEngine(t, sayHelloModule(Tool{Inputs: []ToolInput{
+		{Name: "name", Type: TypeString, Required: true, Pattern: `^[A-Z]`},
+	}}))
+	_, err := w.CallTool(context.Background(), "hello", "say_hello", map[string]any{"name": "bob"})
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeInvalidArguments {
+		t.Fatalf("error %v, want %s", err, ErrCodeInvalidArguments)
+	}
+	if len(toolErr.Violations) != 1 || toolErr.Violations[0].Path != "name" {
+		t.Errorf("violations %v, want one at name", toolErr.Violations)
+	}
+}
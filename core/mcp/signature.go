@@ -0,0 +1,146 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Values of signature_policy
+const (
+	SignaturePolicyEnforce = "enforce"
+	SignaturePolicyWarn    = "warn"
+	SignaturePolicyOff     = "off"
+)
+
+// ModuleFile is one WASM file of a module. Name is the base name of a local
+// file, or the file's name in the module's CAR.
+type ModuleFile struct {
+	Name string
+	Data []byte
+}
+
+// ModuleContentHash is the hash a module's publisher signs and receipts
+// report as module_sha256. It is the SHA-256 of the module's files in
+// byte-wise order of name, each written as the 8-byte big-endian length of
+// its name, the name, the 8-byte big-endian length of its contents and the
+// contents.
+func ModuleContentHash(files []ModuleFile) []byte {
+	files = slices.Clone(files)
+	slices.SortFunc(files, func(a, b ModuleFile) int { return strings.Compare(a.Name, b.Name) })
+
+	h := sha256.New()
+	for _, file := range files {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(file.Name))))
+		h.Write([]byte(file.Name))
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(file.Data))))
+		h.Write(file.Data)
+	}
+	return h.Sum(nil)
+}
+
+// SignModule signs the content hash of a module's files with personal_sign
+// (EIP-191)
+func (w *Wallet) SignModule(files []ModuleFile) ([]byte, error) {
+	return w.SignMessage(ModuleContentHash(files))
+}
+
+// ParseModuleSignature reads a detached signature given as 0x-prefixed hex
+// or as the raw 65 bytes
+func ParseModuleSignature(data []byte) ([]byte, error) {
+	if len(data) == crypto.SignatureLength {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, "0x") {
+		text = "0x" + text
+	}
+	signature, err := hexutil.Decode(text)
+	if err != nil {
+		return nil, fmt.Errorf("signature must be hex or %d raw bytes: %w", crypto.SignatureLength, err)
+	}
+	if len(signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("signature must be %d bytes, got %d", crypto.SignatureLength, len(signature))
+	}
+	return signature, nil
+}
+
+// RecoverModulePublisher returns the address that signed the content hash
+// of a module's files
+func RecoverModulePublisher(files []ModuleFile, signature []byte) (common.Address, error) {
+	return RecoverMessageSigner(ModuleContentHash(files), signature)
+}
+
+// checkPublisher verifies that the module's publisher signed its files.
+// The signature comes from the manifest, inline or from signature_file,
+// or else from a .sig file in the module's CAR.
+func checkPublisher(module Module, files []ModuleFile, carSignatures [][]byte) (common.Address, error) {
+	if module.Publisher == "" {
+		return common.Address{}, errors.New("module names no publisher")
+	}
+	publisher := common.HexToAddress(module.Publisher)
+
+	var signatures [][]byte
+	switch {
+	case module.Signature != "":
+		signatures = append(signatures, []byte(module.Signature))
+	case module.SignatureFile != "":
+		data, err := os.ReadFile(module.SignatureFile)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to read signature file: %w", err)
+		}
+		signatures = append(signatures, data)
+	default:
+		signatures = carSignatures
+	}
+	if len(signatures) == 0 {
+		return common.Address{}, errors.New("module has no signature")
+	}
+
+	var signers []string
+	for _, data := range signatures {
+		signature, err := ParseModuleSignature(data)
+		if err != nil {
+			return common.Address{}, err
+		}
+		signer, err := RecoverModulePublisher(files, signature)
+		if err != nil {
+			return common.Address{}, err
+		}
+		if signer == publisher {
+			return signer, nil
+		}
+		signers = append(signers, signer.Hex())
+	}
+	return common.Address{}, fmt.Errorf("module is signed by %s, not by publisher %s", strings.Join(signers, ", "), publisher.Hex())
+}
+
+// verifyPublisher applies the manifest's signature_policy to a fetched
+// module. It returns the verified publisher, or the zero address when the
+// module is loaded unverified. An unset policy means warn, but only for
+// modules that name a publisher: the others were never meant to be signed.
+func verifyPublisher(ctx context.Context, policy string, module Module, files []ModuleFile, carSignatures [][]byte) (common.Address, error) {
+	if policy == SignaturePolicyOff || (policy == "" && module.Publisher == "") {
+		return common.Address{}, nil
+	}
+	publisher, err := checkPublisher(module, files, carSignatures)
+	if err == nil {
+		slog.DebugContext(ctx, "Verified module publisher", "module", module.Name, "publisher", publisher.Hex())
+		return publisher, nil
+	}
+	if policy == SignaturePolicyEnforce {
+		return common.Address{}, fmt.Errorf("publisher verification failed: %w", err)
+	}
+	slog.WarnContext(ctx, "Loading module with unverified publisher", "module", module.Name, "error", err)
+	return common.Address{}, nil
+}
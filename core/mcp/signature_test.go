@@ -0,0 +1,270 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DANP-LABS/DANP-Engine/pkg/ipfs"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+)
+
+// unverifiedLog is the warning logged for a module loaded under warn
+const unverifiedLog = "Loading module with unverified publisher"
+
+// helloFiles returns the files the say_hello module is fetched as
+func helloFiles(t *testing.T) []ModuleFile {
+	t.Helper()
+	files, err := FetchWASM(context.Background(), &Config{}, sayHelloWASM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// newPublisher returns a fresh wallet to sign modules with
+func newPublisher(t *testing.T) *Wallet {
+	t.Helper()
+	wallet, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+// signFiles returns the hex signature of files by wallet
+func signFiles(t *testing.T, wallet *Wallet, files []ModuleFile) string {
+	t.Helper()
+	signature, err := wallet.SignModule(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexutil.Encode(signature)
+}
+
+// loadWithPolicy loads module under a signature policy and returns the
+// plugin, or the load error
+func loadWithPolicy(t *testing.T, policy string, module Module, ipfsConfig IPFSConfig) (*WASMPlugin, error) {
+	t.Helper()
+	w := NewWASMEngine(&Config{SignaturePolicy: policy, IPFS: ipfsConfig})
+	t.Cleanup(func() { w.Close(context.Background()) })
+	if err := w.LoadModule(context.Background(), module); err != nil {
+		return nil, err
+	}
+	plugin, _ := w.Plugin(module.Name)
+	return plugin, nil
+}
+
+func TestModuleContentHash(t *testing.T) {
+	files := []ModuleFile{
+		{Name: "b.wasm", Data: []byte("\x00asm")},
+		{Name: "a.wasm", Data: []byte("x")},
+	}
+	const want = "9b1651ab67b3dae9cbac7455695ba66ee0f3d4be4ba4fed5cf4856f189ff5be8"
+	if got := hex.EncodeToString(ModuleContentHash(files)); got != want {
+		t.Errorf("ModuleContentHash = %s, want %s", got, want)
+	}
+	if got := hex.EncodeToString(ModuleContentHash([]ModuleFile{files[1], files[0]})); got != want {
+		t.Errorf("hash depends on the order files were fetched in: %s", got)
+	}
+	if files[0].Name != "b.wasm" {
+		t.Error("ModuleContentHash reordered its argument")
+	}
+
+	differ := map[string][]ModuleFile{
+		"renamed file":   {{Name: "c.wasm", Data: []byte("\x00asm")}, files[1]},
+		"moved boundary": {{Name: "b.wasm\x00", Data: []byte("asm")}, files[1]},
+		"merged files":   {{Name: "a.wasm", Data: []byte("x\x00asm")}},
+	}
+	for name, other := range differ {
+		if hex.EncodeToString(ModuleContentHash(other)) == want {
+			t.Errorf("%s: same hash as the original files", name)
+		}
+	}
+}
+
+func TestSignaturePolicy(t *testing.T) {
+	files := helloFiles(t)
+	publisher := newPublisher(t)
+	signed := signFiles(t, publisher, files)
+	signedByOther := signFiles(t, newPublisher(t), files)
+
+	// The tampered copy keeps the file name, so only its contents differ
+	tampered := bytes.Clone(files[0].Data)
+	tampered[len(tampered)-1] ^= 0xff
+	tamperedPath := filepath.Join(t.TempDir(), files[0].Name)
+	if err := os.WriteFile(tamperedPath, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	module := func(wasmPath, signature string) Module {
+		m := sayHelloModule(Tool{})
+		m.WASMPath = wasmPath
+		m.Signature = signature
+		if signature != "" {
+			m.Publisher = publisher.Address.Hex()
+		}
+		return m
+	}
+	tests := []struct {
+		name     string
+		policy   string
+		module   Module
+		wantErr  bool
+		verified bool
+		wantWarn bool
+	}{
+		{name: "signed, enforce", policy: SignaturePolicyEnforce, module: module(sayHelloWASM, signed), verified: true},
+		{name: "tampered, enforce", policy: SignaturePolicyEnforce, module: module("file://"+tamperedPath, signed), wantErr: true},
+		{name: "other key, enforce", policy: SignaturePolicyEnforce, module: module(sayHelloWASM, signedByOther), wantErr: true},
+		{name: "other key, warn", policy: SignaturePolicyWarn, module: module(sayHelloWASM, signedByOther), wantWarn: true},
+		{name: "other key, default", policy: "", module: module(sayHelloWASM, signedByOther), wantWarn: true},
+		{name: "other key, off", policy: SignaturePolicyOff, module: module(sayHelloWASM, signedByOther)},
+		{name: "no publisher, warn", policy: SignaturePolicyWarn, module: module(sayHelloWASM, ""), wantWarn: true},
+		{name: "no publisher, default", policy: "", module: module(sayHelloWASM, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t, slog.LevelWarn)
+			plugin, err := loadWithPolicy(t, tt.policy, tt.module, IPFSConfig{})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "publisher verification failed") {
+					t.Fatalf("LoadModule error %v, want a failed publisher verification", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadModule: %v", err)
+			}
+			wantPublisher := ""
+			if tt.verified {
+				wantPublisher = publisher.Address.Hex()
+			}
+			if plugin.Publisher != wantPublisher {
+				t.Errorf("publisher %q, want %q", plugin.Publisher, wantPublisher)
+			}
+			if warned := strings.Contains(buf.String(), unverifiedLog); warned != tt.wantWarn {
+				t.Errorf("warned %v, want %v; log:\n%s", warned, tt.wantWarn, buf)
+			}
+		})
+	}
+}
+
+// publishCAR serves files as a UnixFS directory from a test gateway and
+// returns the IPFS settings that reach it and the directory's CID
+func publishCAR(t *testing.T, files map[string][]byte) (IPFSConfig, string) {
+	t.Helper()
+	store := &memstore.Store{}
+	ls := cidlink.DefaultLinkSystem()
+	ls.SetReadStorage(store)
+	ls.SetWriteStorage(store)
+
+	var entries []dagpb.PBLink
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		link, size, err := builder.BuildUnixFSFile(bytes.NewReader(files[name]), "", &ls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := builder.BuildUnixFSDirectoryEntry(name, int64(size), link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	root, _, err := builder.BuildUnixFSDirectory(entries, &ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCID := root.(cidlink.Link).Cid
+
+	var car bytes.Buffer
+	writable, err := carstorage.NewWritable(&car, []cid.Cid{rootCID}, carv2.WriteAsCarV1(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, data := range store.Bag {
+		if err := writable.Put(context.Background(), key, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writable.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/ipfs/") != rootCID.String() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.car")
+		w.Write(car.Bytes())
+	}))
+	t.Cleanup(srv.Close)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return IPFSConfig{Enable: true, LassieNet: LassieNet{Scheme: "http", Host: host, Port: portNum}}, rootCID.String()
+}
+
+func TestSignatureSources(t *testing.T) {
+	files := helloFiles(t)
+	publisher := newPublisher(t)
+	signature := signFiles(t, publisher, files)
+
+	signatureFile := filepath.Join(t.TempDir(), "hello.wasm.sig")
+	if err := os.WriteFile(signatureFile, []byte(signature+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The CAR holds the WASM under the name it was signed with
+	ipfsConfig, root := publishCAR(t, map[string][]byte{
+		files[0].Name:                     files[0].Data,
+		files[0].Name + ipfs.SignatureExt: []byte(signature),
+	})
+
+	tests := []struct {
+		name   string
+		module Module
+		ipfs   IPFSConfig
+	}{
+		{name: "inline", module: Module{WASMPath: sayHelloWASM, Signature: signature}},
+		{name: "signature_file", module: Module{WASMPath: sayHelloWASM, SignatureFile: signatureFile}},
+		{name: "CAR", module: Module{WASMPath: "IPFS://" + root}, ipfs: ipfsConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module := sayHelloModule(Tool{})
+			module.WASMPath = tt.module.WASMPath
+			module.Signature = tt.module.Signature
+			module.SignatureFile = tt.module.SignatureFile
+			module.Publisher = publisher.Address.Hex()
+
+			plugin, err := loadWithPolicy(t, SignaturePolicyEnforce, module, tt.ipfs)
+			if err != nil {
+				t.Fatalf("LoadModule: %v", err)
+			}
+			if plugin.Publisher != publisher.Address.Hex() {
+				t.Errorf("publisher %q, want %s", plugin.Publisher, publisher.Address.Hex())
+			}
+			if want := hex.EncodeToString(ModuleContentHash(files)); plugin.Hash != want {
+				t.Errorf("plugin hash %s, want the content hash %s", plugin.Hash, want)
+			}
+		})
+	}
+}
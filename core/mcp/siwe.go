@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// siweHeader ends the first line of a Sign-In with Ethereum message
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// SIWEMessage is an EIP-4361 Sign-In with Ethereum message. Times are
+// optional where the standard makes them so and are zero when absent.
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// String renders the message in the text form that is signed
+func (m SIWEMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeader + "\n")
+	b.WriteString(m.Address.Hex() + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "URI: %s\n", m.URI)
+	fmt.Fprintf(&b, "Version: %s\n", m.Version)
+	fmt.Fprintf(&b, "Chain ID: %d\n", m.ChainID)
+	fmt.Fprintf(&b, "Nonce: %s\n", m.Nonce)
+	fmt.Fprintf(&b, "Issued At: %s", m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		fmt.Fprintf(&b, "\nExpiration Time: %s", m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() {
+		fmt.Fprintf(&b, "\nNot Before: %s", m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		fmt.Fprintf(&b, "\nRequest ID: %s", m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, resource := range m.Resources {
+			b.WriteString("\n- " + resource)
+		}
+	}
+	return b.String()
+}
+
+// ParseSIWEMessage parses the text form of an EIP-4361 message
+func ParseSIWEMessage(text string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("message is too short")
+	}
+	domain, ok := strings.CutSuffix(lines[0], siweHeader)
+	if !ok || domain == "" {
+		return nil, errors.New("first line is not a sign-in request")
+	}
+	if !common.IsHexAddress(lines[1]) || !strings.HasPrefix(lines[1], "0x") {
+		return nil, fmt.Errorf("invalid address %q", lines[1])
+	}
+	m := &SIWEMessage{Domain: domain, Address: common.HexToAddress(lines[1])}
+
+	// The optional statement sits between the address and the URI field
+	i := 2
+	var statement []string
+	for ; i < len(lines) && !strings.HasPrefix(lines[i], "URI: "); i++ {
+		if lines[i] != "" {
+			statement = append(statement, lines[i])
+		}
+	}
+	if len(statement) > 1 {
+		return nil, errors.New("statement must be a single line")
+	}
+	m.Statement = strings.Join(statement, "")
+
+	seen := make(map[string]bool)
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "Resources:" {
+			for i++; i < len(lines); i++ {
+				resource, ok := strings.CutPrefix(lines[i], "- ")
+				if !ok {
+					return nil, fmt.Errorf("invalid resource line %q", lines[i])
+				}
+				m.Resources = append(m.Resources, resource)
+			}
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid field line %q", line)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate field %s", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID, err = strconv.ParseInt(value, 10, 64)
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			m.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			m.ExpirationTime, err = time.Parse(time.RFC3339, value)
+		case "Not Before":
+			m.NotBefore, err = time.Parse(time.RFC3339, value)
+		case "Request ID":
+			m.RequestID = value
+		default:
+			return nil, fmt.Errorf("unknown field %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	for _, field := range []string{"URI", "Version", "Chain ID", "Nonce", "Issued At"} {
+		if !seen[field] {
+			return nil, fmt.Errorf("missing field %s", field)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errToolNotFound is returned when a module does not serve the requested tool
+var errToolNotFound = errors.New("tool not found")
+
+// wasmTool is a manifest tool bound to an export of a loaded plugin, with
+// its input encoder, input patterns and MCP definition built once at load
+// time
+type wasmTool struct {
+	tool     Tool
+	encode   inputEncoder
+	patterns inputPatterns
+	mcpTool  mcp.Tool
+}
+
+// prepareTools builds the tools the plugin serves. Tools whose function the
+// module does not export are skipped with a warning.
+func (p *WASMPlugin) prepareTools() error {
+	p.tools = make(map[string]*wasmTool)
+	p.Tools = nil
+
+	for _, tool := range p.module.Tools {
+		if !p.FunctionExists(tool.Name) {
+			slog.Warn("Function not found in WASM module, skipping tool", "module", p.module.Name, "tool", tool.Name)
+			continue
+		}
+
+		// Build the input schema from the manifest parameters
+		slog.Debug("Preparing tool", "module", p.module.Name, "tool", tool.Name, "inputs", len(tool.Inputs))
+		if err := checkToolInputs(tool.Inputs, ""); err != nil {
+			return fmt.Errorf("invalid inputs for tool %s: %w", tool.Name, err)
+		}
+		schema, err := inputSchema(tool.Inputs)
+		if err != nil {
+			return fmt.Errorf("failed to build input schema for tool %s: %w", tool.Name, err)
+		}
+
+		if err := checkToolOutput(tool.Outputs); err != nil {
+			return fmt.Errorf("invalid outputs for tool %s: %w", tool.Name, err)
+		}
+		encode, err := newInputEncoder(tool)
+		if err != nil {
+			return fmt.Errorf("invalid input mode for tool %s: %w", tool.Name, err)
+		}
+
+		// Create tool with description and parameters. mcp.NewTool fills in
+		// a default InputSchema, which cannot be combined with a raw one.
+		mcpTool := mcp.NewToolWithRawSchema(tool.Name, tool.Description, schema)
+		outSchema, hasOutSchema, err := outputSchema(tool.Outputs)
+		if err != nil {
+			return fmt.Errorf("failed to build output schema for tool %s: %w", tool.Name, err)
+		}
+		if hasOutSchema {
+			mcpTool.RawOutputSchema = outSchema
+		}
+
+		p.tools[tool.Name] = &wasmTool{
+			tool:     tool,
+			encode:   encode,
+			patterns: compilePatterns(tool.Inputs),
+			mcpTool:  mcpTool,
+		}
+		p.Tools = append(p.Tools, tool.Name)
+	}
+	return nil
+}
+
+// CallTool runs a tool of the named module end to end: the arguments are
+// validated and encoded, the export runs under the tool's timeout and the
+// output is mapped onto an MCP result. Failures the caller should report
+// to the client are returned as *ToolError.
+func (w *WASMEngine) CallTool(ctx context.Context, module, name string, args map[string]any) (result *mcp.CallToolResult, err error) {
+	ctx, span := tracer.Start(ctx, "tool "+name, trace.WithAttributes(
+		attribute.String("danp.module", module),
+		attribute.String("danp.tool", name)))
+	start := time.Now()
+	defer func() {
+		w.metrics.observeToolCall(module, name, time.Since(start), result, err)
+		if err == nil && result != nil && result.IsError {
+			span.SetStatus(codes.Error, "tool returned an error result")
+		}
+		endSpan(span, err)
+	}()
+
+	for {
+		plugin, ok := w.Plugin(module)
+		if !ok {
+			return nil, fmt.Errorf("WASM module not loaded: %s", module)
+		}
+		result, err = w.callTool(ctx, plugin, name, args)
+		if errors.Is(err, errPluginRetired) {
+			continue
+		}
+		return result, err
+	}
+}
+
+// callTool runs one call on a specific plugin
+func (w *WASMEngine) callTool(ctx context.Context, p *WASMPlugin, name string, args map[string]any) (*mcp.CallToolResult, error) {
+	wt, ok := p.tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not provided by module %s", errToolNotFound, name, p.module.Name)
+	}
+	tool := wt.tool
+
+	// Restricted tools only run for the callers the manifest allows
+	if toolErr := authorizeTool(ctx, tool); toolErr != nil {
+		slog.WarnContext(ctx, "Rejected unauthorized tool call", "module", p.module.Name, "tool", tool.Name, "error", toolErr.Message)
+		return nil, toolErr
+	}
+
+	// Validate arguments before touching the WASM module
+	if violations := validateArguments(tool.Inputs, wt.patterns, args); len(violations) > 0 {
+		toolErr := newToolError(ErrCodeInvalidArguments, "arguments do not match the input schema of %s", tool.Name)
+		toolErr.Violations = violations
+		// Violations may quote argument values, so only their paths are logged
+		paths := make([]string, 0, len(violations))
+		for _, v := range violations {
+			paths = append(paths, v.Path)
+		}
+		slog.InfoContext(ctx, "Rejected tool call with invalid arguments", "module", p.module.Name, "tool", tool.Name, "paths", paths)
+		return nil, toolErr
+	}
+	// Receipts cover the arguments as the caller sent them
+	callArgs := args
+	args = applyDefaults(tool.Inputs, args)
+
+	// Convert the call arguments to WASM input
+	input, err := wt.encode(args)
+	if err != nil {
+		return nil, newToolError(ErrCodeInvalidArguments, "%v", err)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, w.callTimeout(p.module, tool))
+	defer cancel()
+
+	// Call WASM function. Payloads are only logged at debug level and go
+	// through the manifest's redaction rules.
+	redact := w.currentConfig().Logging.Redact
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.DebugContext(ctx, "Calling WASM function", "module", p.module.Name, "tool", tool.Name,
+			"arguments", redact.formatArguments(args))
+	}
+	start := time.Now()
+	output, err := p.Call(callCtx, tool.Name, input)
+	// A failure the module reports itself is a tool result, not a protocol
+	// error, so its output still reaches the client
+	var guestErr *guestError
+	if errors.As(err, &guestErr) {
+		slog.InfoContext(ctx, "Tool reported an error", "module", p.module.Name, "tool", tool.Name, "error", guestErr)
+		result := guestErr.result(tool)
+		w.attachReceipt(ctx, p, tool.Name, callArgs, guestErr.output, result)
+		return result, nil
+	}
+	if err != nil {
+		if !errors.Is(err, errPluginRetired) {
+			slog.WarnContext(ctx, "WASM call failed", "module", p.module.Name, "tool", tool.Name, "error", err)
+		}
+		var toolErr *ToolError
+		if errors.As(err, &toolErr) || errors.Is(err, errPluginRetired) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("WASM call failed: %w", err)
+	}
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.DebugContext(ctx, "WASM function returned", "module", p.module.Name, "tool", tool.Name,
+			"duration", time.Since(start), "output", redact.formatPayload(output))
+	}
+
+	// Map the raw output onto MCP content
+	result, err := buildResult(tool, output)
+	if err != nil {
+		return nil, err
+	}
+	w.attachReceipt(ctx, p, tool.Name, callArgs, output, result)
+	return result, nil
+}
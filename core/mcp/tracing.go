@@ -0,0 +1,308 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters selectable with tracing.exporter
+const (
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+const defaultServiceName = "danp-engine"
+
+// TracingConfig configures OpenTelemetry tracing. Tracing is off unless an
+// exporter is set: otlp sends spans over OTLP/HTTP to Endpoint, file
+// appends them as JSON lines to File.
+type TracingConfig struct {
+	Exporter    string   `yaml:"exporter"`
+	Endpoint    string   `yaml:"endpoint"`
+	Insecure    bool     `yaml:"insecure"`
+	File        string   `yaml:"file"`
+	SampleRatio *float64 `yaml:"sample_ratio"`
+	ServiceName string   `yaml:"service_name"`
+}
+
+// tracer creates the spans of the server, the engine and the IPFS client.
+// It resolves the global provider lazily, so spans are dropped until
+// tracing is configured.
+var tracer = otel.Tracer("github.com/DANP-LABS/DANP-Engine/core/mcp")
+
+// propagator reads and writes W3C trace context and baggage
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// setupTracing installs the global tracer provider described by cfg and
+// returns a function that flushes and stops it
+func setupTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		exporter, file = exp, f
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Tracing enabled", "exporter", cfg.Exporter, "sample_ratio", ratio)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// endSpan records err on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// metaCarrier reads trace context from the _meta of an MCP request, where
+// clients put traceparent, tracestate and baggage as string fields
+type metaCarrier map[string]any
+
+func (c metaCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c metaCarrier) Set(key, value string) { c[key] = value }
+
+func (c metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// contextFromMeta makes the trace context in _meta, when present, the
+// parent of spans started from the returned context. It takes precedence
+// over the HTTP headers of the transport.
+func contextFromMeta(ctx context.Context, meta *mcp.Meta) context.Context {
+	if meta == nil || len(meta.AdditionalFields) == 0 {
+		return ctx
+	}
+	carrier := metaCarrier(meta.AdditionalFields)
+	if carrier.Get("traceparent") == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// messageMeta returns the _meta of a parsed MCP request. Each request type
+// declares its own params struct, so the message is read back as JSON.
+func messageMeta(message any) *mcp.Meta {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil
+	}
+	var request struct {
+		Params struct {
+			Meta *mcp.Meta `json:"_meta"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil
+	}
+	return request.Params.Meta
+}
+
+// traceToolCalls starts a span for every MCP tools/call, parented on the
+// trace context in the request's _meta
+func traceToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx = contextFromMeta(ctx, request.Params.Meta)
+		ctx, span := tracer.Start(ctx, "mcp tools/call",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("mcp.method", string(mcp.MethodToolsCall)),
+				attribute.String("mcp.tool", request.Params.Name),
+			))
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			span.SetAttributes(attribute.String("mcp.session_id", session.SessionID()))
+		}
+		result, err := next(ctx, request)
+		if err == nil && result != nil && result.IsError {
+			span.SetStatus(codes.Error, "tool returned an error result")
+		}
+		endSpan(span, err)
+		return result, err
+	}
+}
+
+// requestSpans traces MCP requests other than tools/call, which
+// traceToolCalls covers with a span its children can attach to. Hooks
+// cannot pass a context on, so these spans are looked up by request ID.
+type requestSpans struct {
+	spans sync.Map
+}
+
+func (r *requestSpans) key(ctx context.Context, id any) string {
+	sessionID := ""
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	return fmt.Sprintf("%s/%v", sessionID, id)
+}
+
+func (r *requestSpans) addHooks(hooks *server.Hooks) {
+	hooks.AddBeforeAny(func(ctx context.Context, id any, method mcp.MCPMethod, message any) {
+		if id == nil || method == mcp.MethodToolsCall {
+			return
+		}
+		ctx = contextFromMeta(ctx, messageMeta(message))
+		_, span := tracer.Start(ctx, "mcp "+string(method),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("mcp.method", string(method))))
+		r.spans.Store(r.key(ctx, id), span)
+	})
+	hooks.AddOnSuccess(func(ctx context.Context, id any, method mcp.MCPMethod, message any, result any) {
+		if span, ok := r.spans.LoadAndDelete(r.key(ctx, id)); ok {
+			endSpan(span.(trace.Span), nil)
+		}
+	})
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		if span, ok := r.spans.LoadAndDelete(r.key(ctx, id)); ok {
+			endSpan(span.(trace.Span), err)
+		}
+	})
+}
+
+// traceHTTP starts a server span for each HTTP request, continuing the
+// trace of the W3C traceparent header when the caller sent one
+func traceHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		// The mux records the matched pattern on the request; the route is
+		// its path, without the method some patterns start with
+		if r.Pattern != "" {
+			route := r.Pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder captures the response status while keeping streaming
+// and connection upgrades working
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		r.status = http.StatusSwitchingProtocols
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response does not support hijacking")
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,119 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID    = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testParentID + "-01"
+)
+
+var (
+	spanExporter     = tracetest.NewInMemoryExporter()
+	installProviders sync.Once
+)
+
+// recordSpans sends the spans of the package tracer to an in-memory
+// exporter, emptied for each test. The global provider can only be
+// installed once, so every test shares it.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	installProviders.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spanExporter.Reset()
+	t.Cleanup(spanExporter.Reset)
+	return spanExporter
+}
+
+// spansByName indexes the recorded spans by name
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestToolCallSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	s := NewMCPServer(&Config{SignaturePolicy: SignaturePolicyOff, Modules: []Module{sayHelloModule(Tool{})}})
+	defer s.wasmEngine.Close(context.Background())
+	session := newTestSession(t, s)
+	ctx := s.server.WithContext(context.Background(), session)
+	exporter.Reset()
+
+	resp := s.server.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call",
+		"params": {"name": "say_hello", "arguments": {"name": "Bob"}, "_meta": {"traceparent": "`+testTraceparent+`"}}}`))
+	if _, ok := resp.(mcp.JSONRPCResponse); !ok {
+		t.Fatalf("tools/call answered %+v", resp)
+	}
+
+	spans := spansByName(exporter)
+	// Each span is the child of the one before it
+	parent := testParentID
+	for _, name := range []string{"mcp tools/call", "tool say_hello", "wasm.call say_hello"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("no %q span among %d spans", name, len(spans))
+		}
+		if got := span.SpanContext.TraceID().String(); got != testTraceID {
+			t.Errorf("%q is in trace %s, want the trace of _meta %s", name, got, testTraceID)
+		}
+		if got := span.Parent.SpanID().String(); got != parent {
+			t.Errorf("%q has parent %s, want %s", name, got, parent)
+		}
+		parent = span.SpanContext.SpanID().String()
+	}
+	acquire, ok := spans["wasm.acquire"]
+	if !ok {
+		t.Fatal("no wasm.acquire span")
+	}
+	if acquire.Parent.SpanID() != spans["tool say_hello"].SpanContext.SpanID() {
+		t.Error("wasm.acquire is not a child of the tool span")
+	}
+}
+
+func TestRequestSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	s := NewMCPServer(&Config{SignaturePolicy: SignaturePolicyOff, Modules: []Module{sayHelloModule(Tool{})}})
+	defer s.wasmEngine.Close(context.Background())
+	session := newTestSession(t, s)
+	exporter.Reset()
+
+	s.server.HandleMessage(s.server.WithContext(context.Background(), session),
+		json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`))
+	if _, ok := spansByName(exporter)["mcp tools/list"]; !ok {
+		t.Error("no span for tools/list")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /probe/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodGet, "/probe/x", nil)
+	r.Header.Set("traceparent", testTraceparent)
+	traceHTTP(mux).ServeHTTP(httptest.NewRecorder(), r)
+	span, ok := spansByName(exporter)["GET /probe/{name}"]
+	if !ok {
+		t.Fatal("no span named after the HTTP route")
+	}
+	for _, attr := range span.Attributes {
+		if attr.Key == "http.route" && attr.Value.AsString() != "/probe/{name}" {
+			t.Errorf("http.route is %q, want the path of the pattern", attr.Value.AsString())
+		}
+	}
+	if span.SpanContext.TraceID().String() != testTraceID || span.Parent.SpanID().String() != testParentID {
+		t.Errorf("HTTP span %s, parent %s does not continue the traceparent header", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+}
@@ -0,0 +1,352 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MCP transports that can be enabled on the listener with
+// server_config.transports
+const (
+	TransportStreamableHTTP = "streamable_http"
+	TransportSSE            = "sse"
+	TransportWebSocket      = "websocket"
+)
+
+// Endpoints of the optional transports; streamable HTTP is served on /
+const (
+	sseEndpoint             = "/sse"
+	messageEndpoint         = "/message"
+	websocketEndpoint       = "/ws"
+	websocketTicketEndpoint = "/ws/ticket"
+)
+
+// wsWriteTimeout bounds a single WebSocket write so that a stalled client
+// cannot hold up responses to its other requests
+const wsWriteTimeout = 10 * time.Second
+
+// wsMaxInflight bounds the requests of one WebSocket connection that run
+// at once; further messages are not read until one of them finishes
+const wsMaxInflight = 16
+
+// wsTicketTTL is how long a WebSocket ticket may wait to be redeemed
+const wsTicketTTL = 30 * time.Second
+
+var knownTransports = []string{TransportStreamableHTTP, TransportSSE, TransportWebSocket}
+
+// enabledTransports returns the configured transports, defaulting to
+// streamable HTTP only
+func (c *Config) enabledTransports() []string {
+	if len(c.Transports) == 0 {
+		return []string{TransportStreamableHTTP}
+	}
+	return c.Transports
+}
+
+// mountTransports registers the handlers of every enabled transport. All
+// of them are backed by the same MCP server, so tools, hooks and
+// notifications behave the same whichever one a client uses.
+func (s *MCPServer) mountTransports(mux *http.ServeMux, config *Config) {
+	for _, transport := range config.enabledTransports() {
+		switch transport {
+		case TransportStreamableHTTP:
+			mux.Handle("/", s.requireAuth(s.closeStreamsOnStop(server.NewStreamableHTTPServer(s.server))))
+			slog.Info("Streamable HTTP transport enabled", "path", "/")
+		case TransportSSE:
+			// A relative message endpoint keeps the server independent of
+			// the host name clients use to reach it
+			sse := server.NewSSEServer(s.server,
+				server.WithUseFullURLForMessageEndpoint(false),
+				server.WithKeepAlive(true))
+			mux.Handle(sseEndpoint, s.requireAuth(s.closeStreamsOnStop(sse.SSEHandler())))
+			mux.Handle(messageEndpoint, s.requireAuth(sse.MessageHandler()))
+			slog.Info("SSE transport enabled", "path", sseEndpoint, "message_path", messageEndpoint)
+		case TransportWebSocket:
+			mux.Handle(websocketEndpoint, s.requireWebSocketAuth(http.HandlerFunc(s.handleWebSocket)))
+			mux.Handle(websocketTicketEndpoint, s.requireAuth(http.HandlerFunc(s.handleWebSocketTicket)))
+			slog.Info("WebSocket transport enabled", "path", websocketEndpoint, "ticket_path", websocketTicketEndpoint)
+		}
+	}
+}
+
+// allowedOrigin reports whether a WebSocket handshake may proceed. Requests
+// without an Origin header do not come from a browser. Browsers may connect
+// from the server's own origin or from one listed in allowed_origins.
+func allowedOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsTickets are one-time credentials for browsers, which cannot set an
+// Authorization header on a WebSocket handshake. An authenticated caller
+// gets one from POST /ws/ticket and passes it as ?ticket= to /ws.
+type wsTickets struct {
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+type wsTicket struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// issue returns a new ticket that stands for principal until it expires
+func (t *wsTickets) issue(principal *Principal) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now()
+	expires := now.Add(wsTicketTTL)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tickets == nil {
+		t.tickets = make(map[string]wsTicket)
+	}
+	for id, old := range t.tickets {
+		if now.After(old.expires) {
+			delete(t.tickets, id)
+		}
+	}
+	t.tickets[ticket] = wsTicket{principal: principal, expires: expires}
+	return ticket, expires, nil
+}
+
+// redeem consumes a ticket and returns the principal it was issued to
+func (t *wsTickets) redeem(ticket string) (*Principal, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issued, ok := t.tickets[ticket]
+	if !ok {
+		return nil, false
+	}
+	delete(t.tickets, ticket)
+	return issued.principal, time.Now().Before(issued.expires)
+}
+
+// handleWebSocketTicket exchanges the caller's credentials for a WebSocket
+// ticket
+func (s *MCPServer) handleWebSocketTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication is not configured, connect to "+websocketEndpoint+" directly", http.StatusNotFound)
+		return
+	}
+	ticket, expires, err := s.wsTickets.issue(principal)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to issue WebSocket ticket", "error", err)
+		http.Error(w, "Failed to issue ticket", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"ticket":     ticket,
+		"expires_at": expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// requireWebSocketAuth accepts a ticket from /ws/ticket in place of the
+// credentials requireAuth looks for
+func (s *MCPServer) requireWebSocketAuth(next http.Handler) http.Handler {
+	authenticated := s.requireAuth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+		principal, ok := s.wsTickets.redeem(ticket)
+		if !ok {
+			slog.WarnContext(r.Context(), "Rejected request: invalid WebSocket ticket", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			writeAuthError(w, `Bearer realm="danp-engine", error="invalid_token"`, errors.New("invalid or expired WebSocket ticket"))
+			return
+		}
+		ctx := WithPrincipal(r.Context(), principal)
+		slog.DebugContext(ctx, "Authenticated request", "method", principal.Method, "ticket", true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// wsSession is the MCP session of one WebSocket connection
+type wsSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	logLevel      atomic.Value
+}
+
+func (s *wsSession) SessionID() string { return s.id }
+
+func (s *wsSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *wsSession) Initialize() { s.initialized.Store(true) }
+
+func (s *wsSession) Initialized() bool { return s.initialized.Load() }
+
+func (s *wsSession) SetLogLevel(level mcp.LoggingLevel) { s.logLevel.Store(level) }
+
+// GetLogLevel defaults to error, as the other transports' sessions do
+func (s *wsSession) GetLogLevel() mcp.LoggingLevel {
+	if level, ok := s.logLevel.Load().(mcp.LoggingLevel); ok {
+		return level
+	}
+	return mcp.LoggingLevelError
+}
+
+// handleWebSocket serves MCP over a WebSocket: each text message carries
+// one JSON-RPC message, and responses and notifications come back the
+// same way. Up to wsMaxInflight requests run concurrently, so a slow tool
+// call does not hold up the rest of the connection.
+func (s *MCPServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.stopCtx.Err() != nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	allowed := s.currentConfig().AllowedOrigins
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"mcp"},
+		CheckOrigin: func(r *http.Request) bool {
+			if allowedOrigin(r, allowed) {
+				return true
+			}
+			slog.WarnContext(r.Context(), "Rejected WebSocket handshake from a disallowed origin", "origin", r.Header.Get("Origin"), "remote_addr", r.RemoteAddr)
+			return false
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxToolBody)
+
+	// Hijacked connections are invisible to http.Server.Shutdown, so Stop
+	// waits for them separately
+	s.streams.Add(1)
+	defer s.streams.Done()
+
+	session := &wsSession{
+		id:            "ws-" + uuid.NewString(),
+		notifications: make(chan mcp.JSONRPCNotification, 100),
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if err := s.server.RegisterSession(ctx, session); err != nil {
+		slog.ErrorContext(ctx, "Failed to register WebSocket session", "error", err)
+		return
+	}
+	defer s.server.UnregisterSession(ctx, session.id)
+	ctx = s.server.WithContext(ctx, session)
+	slog.InfoContext(ctx, "WebSocket session opened", "remote_addr", r.RemoteAddr)
+
+	var writeMu sync.Mutex
+	write := func(message any) {
+		data, err := json.Marshal(message)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to encode WebSocket message", "error", err)
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			slog.WarnContext(ctx, "Failed to write to WebSocket session", "error", err)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				write(notification)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Stop ends the read loop; requests already received still complete
+	stop := context.AfterFunc(s.stopCtx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	var inflight sync.WaitGroup
+	slots := make(chan struct{}, wsMaxInflight)
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && s.stopCtx.Err() == nil {
+				slog.WarnContext(ctx, "WebSocket session read failed", "error", err)
+			}
+			// A client that went away no longer needs its answers
+			if s.stopCtx.Err() == nil {
+				cancel()
+			}
+			break
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		slots <- struct{}{}
+		inflight.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				inflight.Done()
+			}()
+			// Each message is its own request, with its own ID in the log
+			msgCtx := withRequestID(ctx, uuid.NewString())
+			if response := s.server.HandleMessage(msgCtx, json.RawMessage(data)); response != nil {
+				write(response)
+			}
+		}()
+	}
+	inflight.Wait()
+
+	writeMu.Lock()
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+	writeMu.Unlock()
+	slog.InfoContext(ctx, "WebSocket session closed")
+}
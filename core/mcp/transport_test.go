@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"same origin", "http://engine.example.com:18080", nil, true},
+		{"other origin", "https://evil.example.com", nil, false},
+		{"listed origin", "https://dash.example.com", []string{"https://dash.example.com/"}, true},
+		{"unlisted origin", "https://evil.example.com", []string{"https://dash.example.com"}, false},
+		{"wildcard", "https://evil.example.com", []string{"*"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://engine.example.com:18080/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := allowedOrigin(r, tt.allowed); got != tt.want {
+				t.Errorf("allowedOrigin(%q, %v) = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketTicket(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Transports:      []string{TransportWebSocket},
+		Auth:            AuthConfig{APIKeys: []APIKeyConfig{{Principal: "dashboard", Hash: HashAPIKey(key)}}},
+	})
+	mux := http.NewServeMux()
+	s.mountTransports(mux, s.currentConfig())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + websocketEndpoint
+
+	// Without credentials the handshake is refused
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("handshake without credentials: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+websocketTicketEndpoint, nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var issued struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil || issued.Ticket == "" {
+		t.Fatalf("POST %s: %d %v", websocketTicketEndpoint, resp.StatusCode, err)
+	}
+
+	// A browser sends its origin and the ticket instead of a header
+	header := http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?ticket="+issued.Ticket, header)
+	if err != nil {
+		t.Fatalf("handshake with ticket: %v", err)
+	}
+	conn.Close()
+
+	// Tickets are single use
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?ticket="+issued.Ticket, header); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("handshake with a used ticket: %v", err)
+	}
+}
+
+func TestWebSocketRejectsCrossOrigin(t *testing.T) {
+	s := NewMCPServer(&Config{SignaturePolicy: SignaturePolicyOff, Transports: []string{TransportWebSocket}})
+	mux := http.NewServeMux()
+	s.mountTransports(mux, s.currentConfig())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + websocketEndpoint
+
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, header); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross-origin handshake: %v", err)
+	}
+}
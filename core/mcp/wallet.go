@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -80,3 +81,32 @@ func GetOrCreateWallet(path string, password string) (*Wallet, error) {
 	}
 	return LoadWallet(path, password)
 }
+
+// SignMessage signs message the way personal_sign does (EIP-191), returning
+// a 65-byte signature whose recovery byte is 27 or 28
+func (w *Wallet) SignMessage(message []byte) ([]byte, error) {
+	signature, err := crypto.Sign(accounts.TextHash(message), w.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// RecoverMessageSigner returns the address whose key produced an EIP-191
+// signature of message. Recovery bytes of 0/1 and 27/28 are both accepted.
+func RecoverMessageSigner(message, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature must be %d bytes, got %d", crypto.SignatureLength, len(signature))
+	}
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	publicKey, err := crypto.SigToPub(accounts.TextHash(message), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
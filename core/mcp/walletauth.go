@@ -0,0 +1,454 @@
+package mcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AuthMethodWallet is the Principal.Method of Sign-In with Ethereum
+const AuthMethodWallet = "wallet"
+
+// Wallet sign-in endpoints
+const (
+	authChallengeEndpoint = "/auth/challenge"
+	authTokenEndpoint     = "/auth/token"
+)
+
+const (
+	defaultSIWEChainID    = 1
+	defaultNonceTTL       = 5 * time.Minute
+	defaultWalletSession  = time.Hour
+	walletSessionPrefix   = "siwe_"
+	siweStatement         = "Sign in to DANP-Engine"
+	siweClockSkew         = time.Minute
+	maxWalletSessions     = 10000
+	maxSignInRequestBytes = 16 << 10
+)
+
+// WalletAuthConfig enables Sign-In with Ethereum (EIP-4361). A client
+// fetches a nonce from /auth/challenge, signs a SIWE message with it and
+// trades the message and signature at /auth/token for a session token.
+// Domain is the domain messages must name and is required; it is never
+// taken from the request, whose Host the client controls. URI is the
+// origin messages must name, by default https://<domain>.
+// AllowedAddresses, when set, limits who may sign in, and Scopes are
+// granted to every wallet principal.
+type WalletAuthConfig struct {
+	Enable           bool          `yaml:"enable"`
+	Domain           string        `yaml:"domain"`
+	URI              string        `yaml:"uri"`
+	ChainID          int64         `yaml:"chain_id"`
+	AllowedAddresses []string      `yaml:"allowed_addresses"`
+	Scopes           []string      `yaml:"scopes"`
+	NonceTTL         time.Duration `yaml:"nonce_ttl"`
+	SessionTTL       time.Duration `yaml:"session_ttl"`
+}
+
+// SignInChallenge is the response of /auth/challenge. Message is a ready
+// SIWE message for the address the client named, if it named one.
+type SignInChallenge struct {
+	Nonce          string    `json:"nonce"`
+	Domain         string    `json:"domain"`
+	URI            string    `json:"uri"`
+	ChainID        int64     `json:"chain_id"`
+	IssuedAt       time.Time `json:"issued_at"`
+	ExpirationTime time.Time `json:"expiration_time"`
+	Statement      string    `json:"statement"`
+	Message        string    `json:"message,omitempty"`
+}
+
+// SignInRequest is the body of /auth/token: a SIWE message and its EIP-191
+// signature as 0x-prefixed hex
+type SignInRequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// SignInResponse carries the session token issued for an address
+type SignInResponse struct {
+	Token     string    `json:"token"`
+	Address   string    `json:"address"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AddressFromContext returns the Ethereum address of a caller that signed
+// in with its wallet
+func AddressFromContext(ctx context.Context) (common.Address, bool) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.Method != AuthMethodWallet {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(principal.Name), true
+}
+
+// walletAuthenticator issues nonces and session tokens and accepts the
+// tokens as bearer credentials. Nonces are stateless: each carries its
+// expiry and an HMAC under nonceKey, so issuing them holds no memory. Only
+// nonces spent on a sign-in are remembered, until they expire. Sessions
+// live in memory, so they end when the server restarts.
+type walletAuthenticator struct {
+	mu       sync.Mutex
+	config   WalletAuthConfig
+	nonceKey []byte
+	spent    map[string]time.Time
+	sessions map[string]walletSession
+}
+
+type walletSession struct {
+	address common.Address
+	expires time.Time
+}
+
+func newWalletAuthenticator(cfg WalletAuthConfig) *walletAuthenticator {
+	return &walletAuthenticator{
+		config:   cfg,
+		nonceKey: newNonceKey(),
+		spent:    make(map[string]time.Time),
+		sessions: make(map[string]walletSession),
+	}
+}
+
+func newNonceKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate nonce key: %v", err))
+	}
+	return key
+}
+
+// setConfig applies a reloaded configuration. Open sessions survive, but
+// are checked against the new allowlist on their next request. Disabling
+// sign-in also invalidates every outstanding nonce.
+func (a *walletAuthenticator) setConfig(cfg WalletAuthConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config = cfg
+	if !cfg.Enable {
+		a.nonceKey = newNonceKey()
+		clear(a.spent)
+		clear(a.sessions)
+	}
+}
+
+func (a *walletAuthenticator) enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config.Enable
+}
+
+func (a *walletAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || !strings.HasPrefix(token, walletSessionPrefix) {
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := sessionKey(token)
+	session, ok := a.sessions[key]
+	if !ok || !a.config.Enable {
+		return nil, errors.New("unknown wallet session")
+	}
+	if time.Now().After(session.expires) {
+		delete(a.sessions, key)
+		return nil, errors.New("wallet session expired")
+	}
+	if !a.allowed(session.address) {
+		return nil, fmt.Errorf("address %s is not allowed", session.address.Hex())
+	}
+	return &Principal{
+		Name:   session.address.Hex(),
+		Method: AuthMethodWallet,
+		Scopes: slices.Clone(a.config.Scopes),
+		Claims: map[string]any{"address": session.address.Hex(), "chain_id": a.chainID()},
+	}, nil
+}
+
+// allowed checks address against the allowlist. Callers hold mu.
+func (a *walletAuthenticator) allowed(address common.Address) bool {
+	if len(a.config.AllowedAddresses) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(a.config.AllowedAddresses, func(allowed string) bool {
+		return common.HexToAddress(allowed) == address
+	})
+}
+
+// chainID returns the configured chain. Callers hold mu.
+func (a *walletAuthenticator) chainID() int64 {
+	if a.config.ChainID == 0 {
+		return defaultSIWEChainID
+	}
+	return a.config.ChainID
+}
+
+// uri returns the URI sign-in messages must name. Callers hold mu.
+func (a *walletAuthenticator) uri() string {
+	if a.config.URI != "" {
+		return a.config.URI
+	}
+	return "https://" + a.config.Domain
+}
+
+// sameOrigin reports whether two URIs share scheme and host
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+func (a *walletAuthenticator) nonceTTL() time.Duration {
+	if a.config.NonceTTL == 0 {
+		return defaultNonceTTL
+	}
+	return a.config.NonceTTL
+}
+
+func (a *walletAuthenticator) sessionTTL() time.Duration {
+	if a.config.SessionTTL == 0 {
+		return defaultWalletSession
+	}
+	return a.config.SessionTTL
+}
+
+// Layout of a nonce before hex encoding: expiry in Unix seconds, random
+// bytes, then a truncated HMAC-SHA256 of both
+const (
+	nonceExpiryBytes = 8
+	nonceRandomBytes = 8
+	nonceMACBytes    = 16
+	nonceBytes       = nonceExpiryBytes + nonceRandomBytes + nonceMACBytes
+)
+
+// nonceMAC authenticates the expiry and random bytes of a nonce. Callers
+// hold mu.
+func (a *walletAuthenticator) nonceMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, a.nonceKey)
+	mac.Write(payload)
+	return mac.Sum(nil)[:nonceMACBytes]
+}
+
+// checkNonce returns the expiry of a nonce this authenticator issued.
+// Callers hold mu.
+func (a *walletAuthenticator) checkNonce(nonce string) (time.Time, bool) {
+	raw, err := hex.DecodeString(nonce)
+	if err != nil || len(raw) != nonceBytes {
+		return time.Time{}, false
+	}
+	payload, mac := raw[:nonceExpiryBytes+nonceRandomBytes], raw[nonceExpiryBytes+nonceRandomBytes:]
+	if !hmac.Equal(mac, a.nonceMAC(payload)) {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(payload)), 0), true
+}
+
+// challenge issues a nonce, which can be spent on one sign-in
+func (a *walletAuthenticator) challenge() (*SignInChallenge, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	expires := now.Add(a.nonceTTL()).Truncate(time.Second)
+
+	// EIP-4361 nonces are alphanumeric
+	payload := make([]byte, nonceExpiryBytes+nonceRandomBytes)
+	binary.BigEndian.PutUint64(payload, uint64(expires.Unix()))
+	if _, err := rand.Read(payload[nonceExpiryBytes:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(append(payload, a.nonceMAC(payload)...))
+
+	return &SignInChallenge{
+		Nonce:          nonce,
+		Domain:         a.config.Domain,
+		URI:            a.uri(),
+		ChainID:        a.chainID(),
+		IssuedAt:       now.UTC().Truncate(time.Second),
+		ExpirationTime: expires.UTC(),
+		Statement:      siweStatement,
+	}, nil
+}
+
+// signIn verifies a signed SIWE message and opens a session for its address
+func (a *walletAuthenticator) signIn(req SignInRequest) (*SignInResponse, error) {
+	message, err := ParseSIWEMessage(req.Message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIWE message: %w", err)
+	}
+	signature, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token = walletSessionPrefix + token
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+
+	expires, ok := a.checkNonce(message.Nonce)
+	_, spent := a.spent[message.Nonce]
+	switch {
+	case !ok || spent || now.After(expires):
+		return nil, errors.New("unknown or expired nonce")
+	case !strings.EqualFold(message.Domain, a.config.Domain):
+		return nil, fmt.Errorf("message is for domain %s", message.Domain)
+	case !sameOrigin(message.URI, a.uri()):
+		return nil, fmt.Errorf("message is for URI %s, expected %s", message.URI, a.uri())
+	case message.Version != "1":
+		return nil, fmt.Errorf("unsupported SIWE version %s", message.Version)
+	case message.ChainID != a.chainID():
+		return nil, fmt.Errorf("message is for chain %d, expected %d", message.ChainID, a.chainID())
+	case message.IssuedAt.After(now.Add(siweClockSkew)):
+		return nil, errors.New("message is issued in the future")
+	case !message.ExpirationTime.IsZero() && now.After(message.ExpirationTime):
+		return nil, errors.New("message has expired")
+	case !message.NotBefore.IsZero() && message.NotBefore.After(now.Add(siweClockSkew)):
+		return nil, errors.New("message is not valid yet")
+	}
+
+	signer, err := RecoverMessageSigner([]byte(req.Message), signature)
+	if err != nil {
+		return nil, err
+	}
+	if signer != message.Address {
+		return nil, errors.New("signature does not match the message address")
+	}
+	if !a.allowed(signer) {
+		return nil, fmt.Errorf("address %s is not allowed", signer.Hex())
+	}
+
+	if len(a.sessions) >= maxWalletSessions || len(a.spent) >= maxWalletSessions {
+		for key, session := range a.sessions {
+			if now.After(session.expires) {
+				delete(a.sessions, key)
+			}
+		}
+		for nonce, expires := range a.spent {
+			if now.After(expires) {
+				delete(a.spent, nonce)
+			}
+		}
+		if len(a.sessions) >= maxWalletSessions || len(a.spent) >= maxWalletSessions {
+			return nil, errTooManySignIns
+		}
+	}
+	// The nonce is spent, so the signed message cannot be replayed
+	a.spent[message.Nonce] = expires
+	session := walletSession{address: signer, expires: now.Add(a.sessionTTL())}
+	a.sessions[sessionKey(token)] = session
+	return &SignInResponse{Token: token, Address: signer.Hex(), ExpiresAt: session.expires.UTC()}, nil
+}
+
+// errTooManySignIns is returned while the session table is full
+var errTooManySignIns = errors.New("too many pending sign-ins, try again later")
+
+// sessionKey keys the session table by a hash, so that the tokens
+// themselves are not held in memory and map lookups leak nothing useful
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// registerWalletAuthRoutes mounts the sign-in endpoints. They answer 404
+// while wallet sign-in is disabled, so that a reload can turn it on.
+func (s *MCPServer) registerWalletAuthRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+authChallengeEndpoint, s.handleAuthChallenge)
+	mux.HandleFunc("POST "+authTokenEndpoint, s.handleAuthToken)
+}
+
+func (s *MCPServer) handleAuthChallenge(w http.ResponseWriter, r *http.Request) {
+	if !s.walletAuth.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	challenge, err := s.walletAuth.challenge()
+	if err != nil {
+		writeSignInError(w, err)
+		return
+	}
+	if address := r.URL.Query().Get("address"); address != "" {
+		if !common.IsHexAddress(address) {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid address %q", address))
+			return
+		}
+		challenge.Message = SIWEMessage{
+			Domain:         challenge.Domain,
+			Address:        common.HexToAddress(address),
+			Statement:      challenge.Statement,
+			URI:            challenge.URI,
+			Version:        "1",
+			ChainID:        challenge.ChainID,
+			Nonce:          challenge.Nonce,
+			IssuedAt:       challenge.IssuedAt,
+			ExpirationTime: challenge.ExpirationTime,
+		}.String()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeAdminJSON(w, http.StatusOK, challenge)
+}
+
+func (s *MCPServer) handleAuthToken(w http.ResponseWriter, r *http.Request) {
+	if !s.walletAuth.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	var req SignInRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSignInRequestBytes)).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid sign-in request: %w", err))
+		return
+	}
+
+	resp, err := s.walletAuth.signIn(req)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected wallet sign-in", "remote_addr", r.RemoteAddr, "error", err)
+		writeSignInError(w, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Wallet signed in", "address", resp.Address, "expires_at", resp.ExpiresAt)
+	w.Header().Set("Cache-Control", "no-store")
+	writeAdminJSON(w, http.StatusOK, resp)
+}
+
+func writeSignInError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTooManySignIns) {
+		w.Header().Set("Retry-After", "10")
+		writeAdminError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeAdminError(w, http.StatusUnauthorized, err)
+}
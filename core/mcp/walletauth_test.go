@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// signChallenge signs a SIWE message for challenge, changing it with edit
+// first when given
+func signChallenge(t *testing.T, wallet *Wallet, challenge *SignInChallenge, edit func(*SIWEMessage)) SignInRequest {
+	t.Helper()
+	message := SIWEMessage{
+		Domain:         challenge.Domain,
+		Address:        wallet.Address,
+		Statement:      challenge.Statement,
+		URI:            challenge.URI,
+		Version:        "1",
+		ChainID:        challenge.ChainID,
+		Nonce:          challenge.Nonce,
+		IssuedAt:       challenge.IssuedAt,
+		ExpirationTime: challenge.ExpirationTime,
+	}
+	if edit != nil {
+		edit(&message)
+	}
+	text := message.String()
+	signature, err := wallet.SignMessage([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignInRequest{Message: text, Signature: hexutil.Encode(signature)}
+}
+
+func TestWalletSignIn(t *testing.T) {
+	wallet, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newWalletAuthenticator(WalletAuthConfig{Enable: true, Domain: "mcp.example.com"})
+
+	challenge, err := a.challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Domain != "mcp.example.com" || challenge.URI != "https://mcp.example.com" {
+		t.Fatalf("challenge for %s %s, want the configured domain", challenge.Domain, challenge.URI)
+	}
+
+	tests := []struct {
+		name string
+		edit func(*SIWEMessage)
+		want string
+	}{
+		{"other domain", func(m *SIWEMessage) { m.Domain = "evil.example.com" }, "domain"},
+		{"other URI", func(m *SIWEMessage) { m.URI = "https://evil.example.com/login" }, "URI"},
+		{"forged nonce", func(m *SIWEMessage) { m.Nonce = strings.Repeat("0", len(m.Nonce)) }, "nonce"},
+	}
+	for _, tt := range tests {
+		_, err := a.signIn(signChallenge(t, wallet, challenge, tt.edit))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one about the %s", tt.name, err, tt.want)
+		}
+	}
+
+	// A failed attempt leaves the nonce for the real sign-in
+	request := signChallenge(t, wallet, challenge, nil)
+	resp, err := a.signIn(request)
+	if err != nil {
+		t.Fatalf("signIn: %v", err)
+	}
+	if resp.Address != wallet.Address.Hex() {
+		t.Errorf("signed in %s, want %s", resp.Address, wallet.Address.Hex())
+	}
+	if _, err := a.signIn(request); err == nil {
+		t.Error("signed message replayed")
+	}
+}
+
+func TestWalletNonceExpires(t *testing.T) {
+	wallet, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newWalletAuthenticator(WalletAuthConfig{Enable: true, Domain: "mcp.example.com", NonceTTL: time.Second})
+	challenge, err := a.challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := signChallenge(t, wallet, challenge, func(m *SIWEMessage) { m.ExpirationTime = time.Time{} })
+	time.Sleep(2 * time.Second)
+	if _, err := a.signIn(request); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("sign-in with an expired nonce: %v", err)
+	}
+}
+
+func TestWalletDomainRequired(t *testing.T) {
+	v := &configValidator{}
+	v.validateAuth(AuthConfig{Wallet: WalletAuthConfig{Enable: true}})
+	if len(v.problems) == 0 {
+		t.Error("wallet sign-in without a domain passed validation")
+	}
+}
@@ -2,219 +2,636 @@ package mcp
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/DANP-LABS/DANP-Engine/pkg/ipfs"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	extism "github.com/extism/go-sdk"
 	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// WASMEngine manages WASM module execution
+// WASMEngine manages WASM module execution.
+// Plugins are keyed by module name; loading a module under a name that is
+// already in use swaps the new plugin in and retires the old one.
 type WASMEngine struct {
 	plugins map[string]*WASMPlugin
 	mu      sync.Mutex
 	config  *Config
+	stats   *EngineStats
+	metrics *Metrics
+
+	// signer signs the receipts of tool results when set
+	signer *Wallet
 }
 
-// WASMPlugin represents a loaded WASM plugin
+// errPluginRetired is returned by calls that reach a plugin after it was
+// replaced or unloaded
+var errPluginRetired = errors.New("WASM plugin has been retired")
+
+// defaultCallTimeout bounds a tool call when neither the tool, the module
+// nor the server configure a timeout
+const defaultCallTimeout = 30 * time.Second
+
+// WASMPlugin represents a loaded WASM plugin.
+// The module is compiled once; calls run on instances drawn from a
+// bounded pool so that concurrent calls to one module do not serialize.
+// Publisher is the address whose signature of the module verified, if any.
 type WASMPlugin struct {
-	Plugin *extism.Plugin
-	Mutex  sync.Mutex
+	Compiled  *extism.CompiledPlugin
+	Exports   []string
+	Hash      string
+	Publisher string
+	LoadedAt  time.Time
+	Tools     []string
+
+	tools   map[string]*wasmTool
+	pool    *instancePool
+	module  Module
+	stats   *EngineStats
+	metrics *Metrics
+
+	refMu   sync.Mutex
+	active  int
+	retired bool
+	drained chan struct{}
 }
 
 // NewWASMEngine creates a new WASM execution environment
 func NewWASMEngine(config *Config) *WASMEngine {
-	return &WASMEngine{
+	w := &WASMEngine{
 		plugins: make(map[string]*WASMPlugin),
 		config:  config,
+		stats:   NewEngineStats(),
 	}
+	w.metrics = newMetrics(w)
+	return w
+}
+
+// Metrics returns the engine's Prometheus collectors
+func (w *WASMEngine) Metrics() *Metrics {
+	return w.metrics
+}
+
+// Stats returns the engine's resource counters
+func (w *WASMEngine) Stats() *EngineStats {
+	return w.stats
+}
+
+// SetConfig replaces the server settings used for new loads and calls
+func (w *WASMEngine) SetConfig(config *Config) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.config = config
+}
+
+// SetSigner sets the wallet that signs the receipts of tool results
+func (w *WASMEngine) SetSigner(wallet *Wallet) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.signer = wallet
+}
+
+func (w *WASMEngine) currentConfig() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config
 }
 
-// LoadModule loads a WASM module from file or IPFS
-func (w *WASMEngine) LoadModule(ctx context.Context, path string) error {
+// Plugin returns the plugin currently serving the named module
+func (w *WASMEngine) Plugin(name string) (*WASMPlugin, bool) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	plugin, ok := w.plugins[name]
+	return plugin, ok
+}
+
+// WASM path schemes understood by LoadModule
+const (
+	schemeFile = "file"
+	schemeIPFS = "ipfs"
+)
+
+// parseWASMPath splits a wasm_path into its lower-cased scheme and the
+// remainder. A path without "://" has an empty scheme.
+func parseWASMPath(path string) (scheme, target string) {
+	i := strings.Index(path, "://")
+	if i < 0 {
+		return "", path
+	}
+	return strings.ToLower(path[:i]), path[i+3:]
+}
+
+// LoadModule loads a WASM module from file or IPFS, applying the module's
+// memory and fuel budgets. If a module of the same name is already loaded,
+// the new plugin replaces it atomically and the old one is closed once its
+// in-flight calls have finished.
+func (w *WASMEngine) LoadModule(ctx context.Context, module Module) error {
+	ctx, span := tracer.Start(ctx, "module.load", trace.WithAttributes(
+		attribute.String("danp.module", module.Name),
+		attribute.String("danp.wasm_path", module.WASMPath)))
+	start := time.Now()
+	plugin, err := w.compileModule(ctx, module)
+	w.metrics.observeModuleLoad(module.Name, time.Since(start), err)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("Loading WASM module from: %s", path)
+	w.mu.Lock()
+	old := w.plugins[module.Name]
+	w.plugins[module.Name] = plugin
+	w.mu.Unlock()
+
+	if old != nil {
+		slog.InfoContext(ctx, "Replaced WASM module, retiring previous plugin", "module", module.Name)
+		go old.retire(context.Background())
+	}
+	slog.InfoContext(ctx, "Loaded WASM module", "module", module.Name, "wasm_path", module.WASMPath, "hash", plugin.Hash)
+	return nil
+}
 
-	manifest := extism.Manifest{Wasm: []extism.Wasm{}}
+// UnloadModule removes the named module and closes it once its in-flight
+// calls have finished
+func (w *WASMEngine) UnloadModule(ctx context.Context, name string) error {
+	plugin, ok := w.detachModule(name)
+	if !ok {
+		return fmt.Errorf("WASM module not loaded: %s", name)
+	}
+	slog.InfoContext(ctx, "Unloading WASM module", "module", name)
+	return plugin.retire(ctx)
+}
 
+// toolOwners maps every registered tool to the module that provides it
+func (w *WASMEngine) toolOwners() map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	owners := make(map[string]string)
+	for name, plugin := range w.plugins {
+		for _, tool := range plugin.Tools {
+			owners[tool] = name
+		}
+	}
+	return owners
+}
+
+// toolDefinitions maps every registered tool to its manifest definition
+func (w *WASMEngine) toolDefinitions() map[string]Tool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	definitions := make(map[string]Tool)
+	for _, plugin := range w.plugins {
+		for name, tool := range plugin.tools {
+			definitions[name] = tool.tool
+		}
+	}
+	return definitions
+}
+
+// detachModule removes the named module from the engine without closing it,
+// leaving the caller to retire it
+func (w *WASMEngine) detachModule(name string) (*WASMPlugin, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	plugin, ok := w.plugins[name]
+	delete(w.plugins, name)
+	return plugin, ok
+}
+
+// compileModule fetches, compiles and warms a module without installing it
+func (w *WASMEngine) compileModule(ctx context.Context, module Module) (*WASMPlugin, error) {
+	config := w.currentConfig()
+	path := module.WASMPath
+
+	slog.DebugContext(ctx, "Loading WASM module", "module", module.Name, "wasm_path", path)
+
+	manifest := extism.Manifest{
+		Wasm:   []extism.Wasm{},
+		Memory: manifestMemory(module),
+	}
+
+	files, signatures, err := fetchWASM(ctx, config, path, w.metrics.observeIPFSRetrieve)
+	if err != nil {
+		return nil, err
+	}
+	publisher, err := verifyPublisher(ctx, config.SignaturePolicy, module, files, signatures)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		manifest.Wasm = append(manifest.Wasm, extism.WasmData{Data: file.Data})
+	}
+
+	// Closing the module when the call context is done lets timeouts and
+	// client cancellations interrupt a running guest
+	pluginConfig := extism.PluginConfig{
+		RuntimeConfig: wazero.NewRuntimeConfig().WithCloseOnContextDone(true),
+		EnableWasi:    true,
+	}
+
+	// Fuel and var_set are watched by function listeners, which wazero only
+	// installs when the listener factory is present at compile time
+	compileCtx := experimental.WithFunctionListenerFactory(ctx, callListenerFactory{fuel: module.Fuel > 0})
+
+	_, span := tracer.Start(ctx, "wasm.compile")
+	compiled, err := extism.NewCompiledPlugin(compileCtx, manifest, pluginConfig, nil)
+	endSpan(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to compile WASM plugin", "module", module.Name, "error", err)
+		return nil, fmt.Errorf("failed to compile WASM plugin: %w", err)
+	}
+
+	plugin := &WASMPlugin{
+		Compiled: compiled,
+		Hash:     hex.EncodeToString(ModuleContentHash(files)),
+		LoadedAt: time.Now(),
+		pool:     newInstancePool(compiled, module),
+		module:   module,
+		stats:    w.stats,
+		metrics:  w.metrics,
+		drained:  make(chan struct{}),
+	}
+	// Always create one instance up front: it surfaces instantiation
+	// errors at load time and tells us which functions the module exports
+	if err := plugin.pool.warm(ctx, max(module.MinInstances, 1)); err != nil {
+		plugin.pool.close(ctx)
+		slog.ErrorContext(ctx, "Failed to create WASM plugin", "module", module.Name, "error", err)
+		return nil, fmt.Errorf("failed to create WASM plugin: %w", err)
+	}
+	plugin.Exports = plugin.pool.exports()
+	if publisher != (common.Address{}) {
+		plugin.Publisher = publisher.Hex()
+	}
+
+	if err := plugin.prepareTools(); err != nil {
+		plugin.pool.close(ctx)
+		return nil, err
+	}
+
+	return plugin, nil
+}
+
+// FetchWASM reads the WASM files a wasm_path refers to: a local file, an
+// IPFS:// CID, or a bare path or CID for backward compatibility
+func FetchWASM(ctx context.Context, config *Config, path string) ([]ModuleFile, error) {
+	files, _, err := fetchWASM(ctx, config, path, nil)
+	return files, err
+}
+
+// fetchWASM is FetchWASM reporting IPFS retrievals to observe. It also
+// returns the detached signatures found next to the WASM in a CAR.
+func fetchWASM(ctx context.Context, config *Config, path string, observe ipfs.RetrieveObserver) (files []ModuleFile, signatures [][]byte, err error) {
 	// Handle protocol prefixes
-	if strings.HasPrefix(path, "file://") {
+	scheme, target := parseWASMPath(path)
+	if scheme == schemeFile {
 		// File protocol - strip prefix and load from filesystem
-		filePath := strings.TrimPrefix(path, "file://")
+		filePath := target
 		if _, err := os.Stat(filePath); err == nil {
-			log.Printf("Loading WASM module from filesystem: %s", filePath)
-			manifest.Wasm = append(manifest.Wasm, extism.WasmFile{Path: filePath})
+			slog.DebugContext(ctx, "Loading WASM module from filesystem", "path", filePath)
+			file, err := readModuleFile(filePath)
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, file)
 		} else {
-			return fmt.Errorf("WASM module not found: %s", filePath)
+			return nil, nil, fmt.Errorf("WASM module not found: %s", filePath)
 		}
-	} else if strings.HasPrefix(path, "IPFS://") {
+	} else if scheme == schemeIPFS {
 		// IPFS protocol - requires IPFS to be enabled
-		if !w.config.IPFS.Enable {
-			return fmt.Errorf("IPFS support is not enabled")
+		if !config.IPFS.Enable {
+			return nil, nil, fmt.Errorf("IPFS support is not enabled")
 		}
-		cid := strings.TrimPrefix(path, "IPFS://")
-		log.Printf("Loading WASM module from IPFS CID: %s", cid)
+		cid := target
+		slog.DebugContext(ctx, "Loading WASM module from IPFS", "cid", cid)
 		
-		ipfsC := ipfs.NewClient(w.config.IPFS.LassieNet.Scheme,
-			w.config.IPFS.LassieNet.Host,
-			w.config.IPFS.LassieNet.Port,
-			0) // Default timeout
+		ipfsC := newIPFSClient(config, observe)
 
-		data, err := ipfs.ExtractWASMFromCID(ipfsC, cid)
+		files, signatures, err = extractModuleFiles(ctx, ipfsC, cid)
 		if err != nil {
-			return fmt.Errorf("failed to load WASM from IPFS: %w", err)
-		}
-
-		for _, wasmData := range data {
-			manifest.Wasm = append(manifest.Wasm, extism.WasmData{Data: wasmData})
+			return nil, nil, fmt.Errorf("failed to load WASM from IPFS: %w", err)
 		}
+	} else if scheme != "" {
+		return nil, nil, fmt.Errorf("unsupported WASM path scheme: %s", scheme)
 	} else {
 		// No protocol - try direct path (backward compatibility)
 		if _, err := os.Stat(path); err == nil {
-			log.Printf("Loading WASM module from filesystem: %s", path)
-			manifest.Wasm = append(manifest.Wasm, extism.WasmFile{Path: path})
-		} else if w.config.IPFS.Enable {
-			log.Printf("Loading WASM module from IPFS (direct CID): %s", path)
-			ipfsC := ipfs.NewClient(w.config.IPFS.LassieNet.Scheme,
-				w.config.IPFS.LassieNet.Host,
-				w.config.IPFS.LassieNet.Port,
-				0) // Default timeout
-
-			data, err := ipfs.ExtractWASMFromCID(ipfsC, path)
+			slog.DebugContext(ctx, "Loading WASM module from filesystem", "path", path)
+			file, err := readModuleFile(path)
 			if err != nil {
-				return fmt.Errorf("failed to load WASM from IPFS: %w", err)
+				return nil, nil, err
 			}
+			files = append(files, file)
+		} else if config.IPFS.Enable {
+			slog.DebugContext(ctx, "Loading WASM module from IPFS (direct CID)", "cid", path)
+			ipfsC := newIPFSClient(config, observe)
 
-			for _, wasmData := range data {
-				manifest.Wasm = append(manifest.Wasm, extism.WasmData{Data: wasmData})
+			files, signatures, err = extractModuleFiles(ctx, ipfsC, path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to load WASM from IPFS: %w", err)
 			}
 		} else {
-			return fmt.Errorf("WASM module not found: %s", path)
+			return nil, nil, fmt.Errorf("WASM module not found: %s", path)
 		}
 	}
 
-	config := extism.PluginConfig{
-		ModuleConfig: wazero.NewModuleConfig().WithSysWalltime(),
-		EnableWasi:   true,
+	return files, signatures, nil
+}
+
+// readModuleFile reads a local WASM file under its base name
+func readModuleFile(path string) (ModuleFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ModuleFile{}, fmt.Errorf("failed to read WASM module: %w", err)
 	}
+	return ModuleFile{Name: filepath.Base(path), Data: data}, nil
+}
 
-	plugin, err := extism.NewPlugin(ctx, manifest, config, nil)
+// extractModuleFiles retrieves a CID and splits its files into WASM and
+// detached signatures
+func extractModuleFiles(ctx context.Context, client *ipfs.Client, cid string) (wasm []ModuleFile, signatures [][]byte, err error) {
+	files, err := ipfs.ExtractFilesFromCIDContext(ctx, client, cid)
 	if err != nil {
-		log.Printf("Failed to create WASM plugin: %v", err)
-		return fmt.Errorf("failed to create WASM plugin: %w", err)
+		return nil, nil, err
 	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name, ipfs.SignatureExt) {
+			signatures = append(signatures, file.Data)
+		} else {
+			wasm = append(wasm, ModuleFile{Name: file.Name, Data: file.Data})
+		}
+	}
+	return wasm, signatures, nil
+}
 
-	w.plugins[path] = &WASMPlugin{
-		Plugin: plugin,
+// begin registers an in-flight call, failing once the plugin is retired
+func (p *WASMPlugin) begin() bool {
+	p.refMu.Lock()
+	defer p.refMu.Unlock()
+	if p.retired {
+		return false
 	}
+	p.active++
+	return true
+}
 
-	log.Printf("Successfully loaded WASM module: %s", path)
-	return nil
+func (p *WASMPlugin) end() {
+	p.refMu.Lock()
+	defer p.refMu.Unlock()
+	p.active--
+	if p.retired && p.active == 0 {
+		close(p.drained)
+	}
 }
 
-// RegisterWASMTools registers all tools from a WASM module
-func (w *WASMEngine) RegisterWASMTools(s *server.MCPServer, modulePath string, tools []Tool) error {
-	plugin, ok := w.plugins[modulePath]
-	if !ok {
-		log.Printf("WASM module not found during tool registration: %s", modulePath)
-		return fmt.Errorf("WASM module not loaded: %s", modulePath)
+// retire stops the plugin from accepting calls, waits for in-flight calls
+// to finish (or ctx to end) and then closes its instance pool
+func (p *WASMPlugin) retire(ctx context.Context) error {
+	p.refMu.Lock()
+	if !p.retired {
+		p.retired = true
+		if p.active == 0 {
+			close(p.drained)
+		}
 	}
+	p.refMu.Unlock()
 
-	log.Printf("Registering %d tools from WASM module: %s", len(tools), modulePath)
+	var errs []error
+	select {
+	case <-p.drained:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "WASM module closed with calls still in flight", "module", p.module.Name, "error", ctx.Err())
+		errs = append(errs, fmt.Errorf("module %s closed with calls still in flight: %w", p.module.Name, ctx.Err()))
+	}
+	if err := p.pool.close(context.WithoutCancel(ctx)); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close module %s: %w", p.module.Name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// FunctionExists reports whether the module exports the named function
+func (p *WASMPlugin) FunctionExists(name string) bool {
+	for _, export := range p.Exports {
+		if export == name {
+			return true
+		}
+	}
+	return false
+}
 
-	// Check for available functions in the WASM module
-	log.Printf("Checking available functions in WASM module: %s", modulePath)
+// Call runs an exported function on a pooled instance, bounded by ctx and
+// the module's fuel budget. If the call is interrupted or exhausts a budget,
+// the instance is discarded instead of being returned to the pool.
+func (p *WASMPlugin) Call(ctx context.Context, name string, input []byte) (output []byte, err error) {
+	if !p.begin() {
+		return nil, errPluginRetired
+	}
+	defer p.end()
 
-	for _, tool := range tools {
-		log.Printf("Registering tool: %s", tool.Name)
-		
-		// Check if the function exists in the WASM module
-		functionExists := plugin.Plugin.FunctionExists(tool.Name)
-		
-		if !functionExists {
-			log.Printf("Warning: Function %s not found in WASM module, skipping", tool.Name)
-			continue
+	_, acquireSpan := tracer.Start(ctx, "wasm.acquire",
+		trace.WithAttributes(attribute.String("danp.module", p.module.Name)))
+	waitStart := time.Now()
+	instance, err := p.pool.acquire(ctx)
+	p.metrics.observePoolWait(p.module.Name, time.Since(waitStart))
+	endSpan(acquireSpan, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPoolBusy):
+			return nil, newToolError(ErrCodeBusy, "no instance of module %s became available in time", p.module.Name)
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, newToolError(ErrCodeTimeout, "%s timed out waiting for an instance", name)
+		case errors.Is(err, context.Canceled):
+			return nil, newToolError(ErrCodeCancelled, "%s was cancelled", name)
 		}
-		
-		// Create tool with description and parameters
-		toolOptions := []mcp.ToolOption{
-			mcp.WithDescription(tool.Description),
+		return nil, fmt.Errorf("failed to acquire WASM instance: %w", err)
+	}
+	discard := false
+	defer func() { p.pool.release(instance, discard) }()
+
+	callCtx, call := withHostCall(ctx)
+	budget := p.pool.memoryBudget(instance)
+	if budget != nil {
+		budget.refused.Store(false)
+	}
+	var meter *fuelMeter
+	if p.module.Fuel > 0 {
+		callCtx, meter = withFuelMeter(callCtx, p.module.Fuel)
+		defer meter.cancel(nil)
+	}
+
+	_, span := tracer.Start(ctx, "wasm.call "+name, trace.WithAttributes(
+		attribute.String("danp.module", p.module.Name),
+		attribute.String("wasm.function", name),
+		attribute.Int("wasm.input_bytes", len(input))))
+	defer func() { endSpan(span, err) }()
+
+	exitCode, output, err := instance.CallWithContext(callCtx, name, input)
+	if meter != nil && meter.exhausted() {
+		slog.WarnContext(ctx, "WASM call exhausted its fuel budget, discarding instance", "module", p.module.Name, "function", name, "fuel", p.module.Fuel)
+		discard = true
+		return nil, p.resourceExhausted(ResourceFuel, name)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		slog.WarnContext(ctx, "WASM call interrupted, discarding instance", "module", p.module.Name, "function", name, "error", ctxErr)
+		discard = true
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, newToolError(ErrCodeTimeout, "%s did not complete before its deadline", name)
 		}
-		
-		// Add input parameters - we don't use schema in this version
-		// Just log the parameters for debugging
-		log.Printf("Tool %s has %d input parameters", tool.Name, len(tool.Inputs))
-		for _, input := range tool.Inputs {
-			log.Printf("  Parameter: %s (type: %s, required: %v)", 
-				input.Name, input.Type, input.Required)
+		return nil, newToolError(ErrCodeCancelled, "%s was cancelled", name)
+	}
+	if err != nil {
+		if resource := exhaustedResource(budget, call, err); resource != "" {
+			slog.WarnContext(ctx, "WASM call exhausted a resource budget, discarding instance", "module", p.module.Name, "function", name, "resource", resource, "error", err)
+			discard = true
+			return nil, p.resourceExhausted(resource, name)
 		}
-		
-		// Create the tool
-		t := mcp.NewTool(tool.Name, toolOptions...)
+		// An error the guest set itself, as opposed to a trap
+		if message := instance.GetErrorWithContext(ctx); message != "" {
+			return nil, &guestError{exitCode: exitCode, output: output, message: message}
+		}
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, &guestError{exitCode: exitCode, output: output}
+	}
+	return output, nil
+}
+
+// Call runs a function of the named module on whichever plugin currently
+// serves it, following the module across reloads
+func (w *WASMEngine) Call(ctx context.Context, module, name string, input []byte) ([]byte, error) {
+	for {
+		plugin, ok := w.Plugin(module)
+		if !ok {
+			return nil, fmt.Errorf("WASM module not loaded: %s", module)
+		}
+		output, err := plugin.Call(ctx, name, input)
+		if errors.Is(err, errPluginRetired) {
+			continue
+		}
+		return output, err
+	}
+}
 
-		// Register the tool handler
-		s.AddTool(t, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			plugin.Mutex.Lock()
-			defer plugin.Mutex.Unlock()
+func (p *WASMPlugin) resourceExhausted(resource, name string) *ToolError {
+	p.stats.recordExhausted(p.module.Name, resource)
+	return newToolError(ErrCodeResourceExhausted, "%s exceeded the %s budget of module %s", name, resource, p.module.Name)
+}
 
-			// Convert MCP request to WASM input
-			input, err := json.Marshal(req.Params)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal input: %w", err)
-			}
+// callTimeout resolves the timeout of a tool: the tool's own setting wins,
+// then the module's, then the server-wide timeout
+func (w *WASMEngine) callTimeout(module Module, tool Tool) time.Duration {
+	switch {
+	case tool.Timeout > 0:
+		return tool.Timeout
+	case module.Timeout > 0:
+		return module.Timeout
+	case w.currentConfig().Timeout > 0:
+		return w.currentConfig().Timeout
+	default:
+		return defaultCallTimeout
+	}
+}
 
-			// Call WASM function
-			log.Printf("Calling WASM function: %s with input: %s", tool.Name, string(input))
-			_, output, err := plugin.Plugin.Call(tool.Name, input)
+// RegisterWASMTools registers all tools from a WASM module in one batch,
+// so clients receive a single tools/list_changed notification. Tools that
+// the previous plugin of the module registered but the new one does not
+// are removed.
+func (w *WASMEngine) RegisterWASMTools(s *server.MCPServer, module Module, previous []string) error {
+	var changes toolChanges
+	if err := w.collectTools(&changes, module, previous); err != nil {
+		return err
+	}
+	changes.apply(s)
+	return nil
+}
+
+// collectTools records the tools of a module's plugin in changes, along
+// with the previous tools the plugin no longer provides
+func (w *WASMEngine) collectTools(changes *toolChanges, module Module, previous []string) error {
+	plugin, ok := w.Plugin(module.Name)
+	if !ok {
+		slog.Error("WASM module not found during tool registration", "module", module.Name)
+		return fmt.Errorf("WASM module not loaded: %s", module.WASMPath)
+	}
+
+	slog.Info("Registering tools from WASM module", "module", module.Name, "tools", len(plugin.Tools))
+
+	for _, name := range plugin.Tools {
+		name := name
+		handler := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := w.CallTool(ctx, module.Name, name, req.GetArguments())
 			if err != nil {
-				log.Printf("WASM call failed for %s: %v", tool.Name, err)
-				return nil, fmt.Errorf("WASM call failed: %w", err)
-			}
-			log.Printf("WASM function %s executed successfully with output: %s", tool.Name, string(output))
-
-			// Create MCP result
-			result := &mcp.CallToolResult{
-				Content: []mcp.Content{
-					mcp.TextContent{
-						Type: "text",
-						Text: string(output),
-					},
-				},
+				var toolErr *ToolError
+				if errors.As(err, &toolErr) {
+					return toolErr.Result(), nil
+				}
+				return nil, err
 			}
-
 			return result, nil
-		})
-		
-		log.Printf("Successfully registered tool: %s", tool.Name)
+		}
+		changes.add = append(changes.add, server.ServerTool{Tool: plugin.tools[name].mcpTool, Handler: handler})
+		slog.Debug("Registered tool", "module", module.Name, "tool", name)
 	}
 
+	var stale []string
+	for _, name := range previous {
+		if !slices.Contains(plugin.Tools, name) {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		slog.Info("Removing tools no longer provided by module", "module", module.Name, "tools", stale)
+		changes.remove = append(changes.remove, stale...)
+	}
 	return nil
 }
 
-// Close cleans up WASM resources
+// Close cleans up WASM resources. Plugins stop accepting calls at once and
+// are closed in parallel as their in-flight calls finish, or when ctx is done.
 func (w *WASMEngine) Close(ctx context.Context) error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	plugins := w.plugins
+	w.plugins = make(map[string]*WASMPlugin)
+	w.mu.Unlock()
 
-	log.Printf("Cleaning up %d WASM plugins", len(w.plugins))
+	slog.InfoContext(ctx, "Cleaning up WASM plugins", "plugins", len(plugins))
 
-	for path, plugin := range w.plugins {
-		log.Printf("Closing WASM plugin: %s", path)
-		if err := plugin.Plugin.Close(ctx); err != nil {
-			log.Printf("Failed to close WASM plugin %s: %v", path, err)
-			return err
-		}
-		log.Printf("Successfully closed WASM plugin: %s", path)
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(plugins))
+	var errMu sync.Mutex
+	for name, plugin := range plugins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.DebugContext(ctx, "Closing WASM plugin", "module", name)
+			if err := plugin.retire(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to close WASM plugin", "module", name, "error", err)
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+				return
+			}
+			slog.DebugContext(ctx, "Closed WASM plugin", "module", name)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
-	log.Println("All WASM plugins closed")
+	slog.InfoContext(ctx, "All WASM plugins closed")
 	return nil
 }
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// loopWASM exports loop, which never returns, and ok, which returns 0
+var loopWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type: () -> i32
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	// functions: loop, ok
+	0x03, 0x03, 0x02, 0x00, 0x00,
+	// exports: loop, ok
+	0x07, 0x0d, 0x02,
+	0x04, 'l', 'o', 'o', 'p', 0x00, 0x00,
+	0x02, 'o', 'k', 0x00, 0x01,
+	// code
+	0x0a, 0x0f, 0x02,
+	// loop: loop { br 0 }; unreachable
+	0x08, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b,
+	// ok: return 0
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+}
+
+func loopModule(t *testing.T, timeout time.Duration) Module {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "loop.wasm")
+	if err := os.WriteFile(path, loopWASM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Module{
+		Name:         "loop",
+		WASMPath:     "file://" + path,
+		MinInstances: 1,
+		MaxInstances: 1,
+		Tools:        []Tool{{Name: "loop", Timeout: timeout}, {Name: "ok"}},
+	}
+}
+
+// idleInstances returns the instances idle in the module's pool
+func idleInstances(w *WASMEngine, module string) []idleInstance {
+	plugin, _ := w.Plugin(module)
+	plugin.pool.mu.Lock()
+	defer plugin.pool.mu.Unlock()
+	return append([]idleInstance(nil), plugin.pool.idle...)
+}
+
+func TestCallTimeoutInterruptsGuest(t *testing.T) {
+	w := newTestEngine(t, loopModule(t, 100*time.Millisecond))
+	before := idleInstances(w, "loop")
+	if len(before) != 1 {
+		t.Fatalf("pool holds %d idle instances, want 1", len(before))
+	}
+
+	start := time.Now()
+	_, err := w.CallTool(context.Background(), "loop", "loop", nil)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeTimeout {
+		t.Fatalf("error %v, want %s", err, ErrCodeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call returned after %v, long past its 100ms timeout", elapsed)
+	}
+
+	// The interrupted instance is closed and a fresh one takes its place
+	waitPoolSize(t, w, "loop", 1)
+	if after := idleInstances(w, "loop"); after[0].plugin == before[0].plugin {
+		t.Error("interrupted instance was returned to the pool")
+	}
+
+	result, err := w.CallTool(context.Background(), "loop", "ok", nil)
+	if err != nil {
+		t.Fatalf("call after the timeout: %v", err)
+	}
+	if result.IsError {
+		t.Errorf("call after the timeout failed: %+v", result)
+	}
+}
+
+func TestCallTimeoutPrecedence(t *testing.T) {
+	w := NewWASMEngine(&Config{Timeout: 3 * time.Second})
+	tests := []struct {
+		module Module
+		tool   Tool
+		want   time.Duration
+	}{
+		{Module{}, Tool{}, 3 * time.Second},
+		{Module{Timeout: 2 * time.Second}, Tool{}, 2 * time.Second},
+		{Module{Timeout: 2 * time.Second}, Tool{Timeout: time.Second}, time.Second},
+	}
+	for _, tt := range tests {
+		if got := w.callTimeout(tt.module, tt.tool); got != tt.want {
+			t.Errorf("callTimeout(%v, %v) = %v, want %v", tt.module.Timeout, tt.tool.Timeout, got, tt.want)
+		}
+	}
+	if got := NewWASMEngine(&Config{}).callTimeout(Module{}, Tool{}); got != defaultCallTimeout {
+		t.Errorf("callTimeout without settings = %v, want %v", got, defaultCallTimeout)
+	}
+}
+
+func TestCancelledNotificationStopsGuest(t *testing.T) {
+	s := NewMCPServer(&Config{
+		SignaturePolicy: SignaturePolicyOff,
+		Modules:         []Module{loopModule(t, time.Minute)},
+	})
+	t.Cleanup(func() { s.wasmEngine.Close(context.Background()) })
+	if _, ok := s.wasmEngine.Plugin("loop"); !ok {
+		t.Fatal("loop module not loaded")
+	}
+
+	responses := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		responses <- s.server.HandleMessage(context.Background(),
+			json.RawMessage(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"loop"}}`))
+	}()
+
+	// Cancel once the guest holds the only instance
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if len(idleInstances(s.wasmEngine, "loop")) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tool call never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.server.HandleMessage(context.Background(),
+		json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7}}`))
+
+	select {
+	case response := <-responses:
+		result, ok := response.(mcp.JSONRPCResponse)
+		if !ok {
+			t.Fatalf("response %+v, want a tool result", response)
+		}
+		data, _ := json.Marshal(result.Result)
+		var call mcp.CallToolResult
+		if err := json.Unmarshal(data, &call); err != nil {
+			t.Fatal(err)
+		}
+		structured, _ := call.StructuredContent.(map[string]any)
+		toolErr, _ := structured["error"].(map[string]any)
+		if !call.IsError || toolErr["code"] != ErrCodeCancelled {
+			t.Errorf("result %s, want a %s error", data, ErrCodeCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled call kept running")
+	}
+}
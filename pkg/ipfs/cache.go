@@ -0,0 +1,202 @@
+package ipfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DefaultCacheMaxBytes bounds a cache opened without a size
+const DefaultCacheMaxBytes = 1 << 30
+
+// ErrTooLargeToCache is returned by Put for a CAR that exceeds the cache's
+// size bound on its own
+var ErrTooLargeToCache = errors.New("CAR is larger than the cache")
+
+// cacheExt names the cached CAR files, one per CID
+const cacheExt = ".car"
+
+// Cache keeps verified CARs on disk, keyed by the CID they are rooted at.
+// When the cached CARs outgrow the size bound, the least recently used
+// are evicted. Entries are verified again on every read, so a corrupted or
+// altered file is discarded rather than served.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// OpenCache opens the cache in dir, creating the directory if needed.
+// maxBytes bounds the total size of the cached CARs; zero or less uses
+// DefaultCacheMaxBytes.
+func OpenCache(dir string, maxBytes int64) (*Cache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	c := &Cache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*cacheEntry)}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		key, ok := strings.CutSuffix(file.Name(), cacheExt)
+		if !ok {
+			if strings.Contains(file.Name(), ".tmp") {
+				// Left behind by a write that did not finish
+				os.Remove(filepath.Join(dir, file.Name()))
+			}
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		// File modification times carry the recency of use across restarts
+		c.entries[key] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+	c.mu.Lock()
+	c.evict("")
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Dir returns the directory the cache is stored in
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the cached CAR of a CID after verifying it. Entries that no
+// longer verify are deleted and reported as missing.
+func (c *Cache) Get(id cid.Cid) ([]byte, bool) {
+	key := id.String()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	// Read and verify without the lock, so one large entry does not hold up
+	// every other lookup
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		_, err = verifyCAR(id, bytes.NewReader(data))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Leave the entry alone if a Put replaced or eviction removed it meanwhile
+	current := c.entries[key] == entry
+	if err != nil {
+		if current {
+			log.Printf("Discarding cached CAR %s: %v", key, err)
+			c.remove(key)
+		}
+		return nil, false
+	}
+	if current {
+		entry.used = time.Now()
+		os.Chtimes(path, entry.used, entry.used)
+	}
+	return data, true
+}
+
+// Put stores the verified CAR of a CID, evicting the least recently used
+// entries to stay within the size bound. A CAR larger than the bound
+// itself is not stored and fails with ErrTooLargeToCache.
+func (c *Cache) Put(id cid.Cid, data []byte) error {
+	key := id.String()
+	if int64(len(data)) > c.maxBytes {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTooLargeToCache, len(data), c.maxBytes)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Write through a temporary file so a crash never leaves a partial CAR
+	tmp, err := os.CreateTemp(c.dir, key+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	if old, ok := c.entries[key]; ok {
+		c.size -= old.size
+	}
+	c.entries[key] = &cacheEntry{size: int64(len(data)), used: time.Now()}
+	c.size += int64(len(data))
+	c.evict(key)
+	return nil
+}
+
+// evict removes the least recently used entries other than keep until the
+// cache fits its size bound. c.mu must be held.
+func (c *Cache) evict(keep string) {
+	if c.size <= c.maxBytes {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		if key != keep {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].used.Before(c.entries[keys[j]].used)
+	})
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			break
+		}
+		log.Printf("Evicting cached CAR %s", key)
+		c.remove(key)
+	}
+}
+
+// remove deletes an entry and its file. c.mu must be held.
+func (c *Cache) remove(key string) {
+	if entry, ok := c.entries[key]; ok {
+		c.size -= entry.size
+		delete(c.entries, key)
+	}
+	os.Remove(c.path(key))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheExt)
+}
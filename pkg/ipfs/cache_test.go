@@ -0,0 +1,121 @@
+package ipfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+)
+
+// cachedCAR returns a CAR of a single raw block and the CID it is rooted at
+func cachedCAR(t *testing.T, data string) (cid.Cid, []byte) {
+	t.Helper()
+	block := rawBlock(t, data)
+	return block.cid, buildCAR(t, []cid.Cid{block.cid}, block)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	a, carA := cachedCAR(t, "module a")
+	b, carB := cachedCAR(t, "module b")
+	c, carC := cachedCAR(t, "module c")
+	cache, err := OpenCache(t.TempDir(), int64(len(carA)+len(carB)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, car := range map[cid.Cid][]byte{a: carA, b: carB} {
+		if err := cache.Put(id, car); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	// Reading a makes b the least recently used
+	if _, ok := cache.Get(a); !ok {
+		t.Fatal("Get(a) missed")
+	}
+	if err := cache.Put(c, carC); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, ok := cache.Get(b); ok {
+		t.Error("b was not evicted")
+	}
+	for name, id := range map[string]cid.Cid{"a": a, "c": c} {
+		if _, ok := cache.Get(id); !ok {
+			t.Errorf("%s was evicted", name)
+		}
+	}
+	if _, err := os.Stat(cache.path(b.String())); !os.IsNotExist(err) {
+		t.Errorf("evicted CAR is still on disk: %v", err)
+	}
+}
+
+func TestCacheRefusesOversizedCAR(t *testing.T) {
+	small, smallCAR := cachedCAR(t, "small")
+	large, largeCAR := cachedCAR(t, "a module larger than the whole cache")
+	cache, err := OpenCache(t.TempDir(), int64(len(smallCAR)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(small, smallCAR); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if err := cache.Put(large, largeCAR); !errors.Is(err, ErrTooLargeToCache) {
+		t.Fatalf("Put: error %v, want %v", err, ErrTooLargeToCache)
+	}
+	if _, ok := cache.Get(small); !ok {
+		t.Error("an oversized Put evicted the cached CAR")
+	}
+	if cache.size > cache.maxBytes {
+		t.Errorf("cache holds %d bytes, bound %d", cache.size, cache.maxBytes)
+	}
+}
+
+func TestCacheDiscardsCorruptCAR(t *testing.T) {
+	id, car := cachedCAR(t, "module")
+	cache, err := OpenCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(id, car); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	_, tampered := cachedCAR(t, "tampered")
+	if err := os.WriteFile(cache.path(id.String()), tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(id); ok {
+		t.Fatal("Get returned a CAR that does not match its CID")
+	}
+	if _, err := os.Stat(cache.path(id.String())); !os.IsNotExist(err) {
+		t.Errorf("corrupt CAR is still on disk: %v", err)
+	}
+	if cache.size != 0 {
+		t.Errorf("cache size %d after discarding its only entry", cache.size)
+	}
+}
+
+func TestOfflineClientServesOnlyCache(t *testing.T) {
+	cached, car := cachedCAR(t, "cached module")
+	missing, _ := cachedCAR(t, "missing module")
+	cache, err := OpenCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(cached, car); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// The gateway serves nothing, so any request to it would fail otherwise
+	client := newTestGateway(t, nil)
+	client.SetCache(cache)
+	client.SetOffline(true)
+
+	if _, err := client.Retrieve(cached.String()); err != nil {
+		t.Errorf("Retrieve(cached): %v", err)
+	}
+	if _, err := client.Retrieve(missing.String()); !errors.Is(err, ErrOffline) {
+		t.Errorf("Retrieve(missing): error %v, want %v", err, ErrOffline)
+	}
+}
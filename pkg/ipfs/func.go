@@ -1,8 +1,13 @@
 package ipfs
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ExtractWASMFromCID retrieves WASM files from IPFS by CID and returns them as byte slices.
@@ -10,8 +15,40 @@ import (
 // cid: Content Identifier of the data to retrieve
 // Returns: Slice of WASM file contents and any error encountered
 func ExtractWASMFromCID(client *Client, cid string) ([][]byte, error) {
+	return ExtractWASMFromCIDContext(context.Background(), client, cid)
+}
+
+// SignatureExt marks the detached signature files published alongside WASM
+// in a CAR; they are not returned as WASM.
+const SignatureExt = ".sig"
+
+// File is a file extracted from a CAR
+type File struct {
+	Name string
+	Data []byte
+}
+
+// ExtractWASMFromCIDContext is ExtractWASMFromCID bounded by ctx, tracing
+// the retrieval and the CAR extraction as spans of the trace in ctx.
+func ExtractWASMFromCIDContext(ctx context.Context, client *Client, cid string) ([][]byte, error) {
+	files, err := ExtractFilesFromCIDContext(ctx, client, cid)
+	if err != nil {
+		return nil, err
+	}
+	var wasmFiles [][]byte
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name, SignatureExt) {
+			wasmFiles = append(wasmFiles, file.Data)
+		}
+	}
+	return wasmFiles, nil
+}
+
+// ExtractFilesFromCIDContext retrieves a CID and returns the files at the
+// top level of its CAR, in name order, signatures included.
+func ExtractFilesFromCIDContext(ctx context.Context, client *Client, cid string) ([]File, error) {
 	// Retrieve CAR data from IPFS
-	data, err := client.Retrieve(cid)
+	data, err := client.RetrieveContext(ctx, cid)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve CID: %w", err)
 	}
@@ -37,7 +74,12 @@ func ExtractWASMFromCID(client *Client, cid string) ([][]byte, error) {
 	defer os.RemoveAll(extractDir)
 
 	// Extract CAR file contents
-	if _, err := ExtractCarFile(carFile.Name(), extractDir); err != nil {
+	_, span := tracer.Start(ctx, "ipfs.ExtractCarFile",
+		trace.WithAttributes(attribute.String("ipfs.cid", cid), attribute.Int("ipfs.car_bytes", len(data))))
+	extracted, err := ExtractCarFile(carFile.Name(), extractDir)
+	span.SetAttributes(attribute.Int("ipfs.files", extracted))
+	endSpan(span, err)
+	if err != nil {
 		return nil, fmt.Errorf("failed to extract CAR file: %w", err)
 	}
 
@@ -47,7 +89,7 @@ func ExtractWASMFromCID(client *Client, cid string) ([][]byte, error) {
 		return nil, fmt.Errorf("failed to read extract dir: %w", err)
 	}
 
-	var wasmFiles [][]byte
+	var files []File
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -59,8 +101,8 @@ func ExtractWASMFromCID(client *Client, cid string) ([][]byte, error) {
 			return nil, fmt.Errorf("failed to read file %s: %w", entry.Name(), err)
 		}
 
-		wasmFiles = append(wasmFiles, content)
+		files = append(files, File{Name: entry.Name(), Data: content})
 	}
 
-	return wasmFiles, nil
+	return files, nil
 }
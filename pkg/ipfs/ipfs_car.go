@@ -16,6 +16,7 @@ import (
 	"github.com/ipfs/go-unixfsnode/file"
 	dagpb "github.com/ipld/go-codec-dagpb"
 	"github.com/ipld/go-ipld-prime"
+	_ "github.com/ipld/go-ipld-prime/codec/raw" // Raw leaves of UnixFS files
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 )
@@ -182,7 +183,7 @@ func extractDir(ls *ipld.LinkSystem, n ipld.Node, outputRoot, outputPath string,
 		dest, err := ls.Load(ipld.LinkContext{}, vl, basicnode.Prototype.Any)
 		if err != nil {
 			if nf, ok := err.(interface{ NotFound() bool }); ok && nf.NotFound() {
-				fmt.Printf("data for entry not found: %s (skipping...)\n", path.Join(outputPath, name))
+				log.Printf("data for entry not found: %s (skipping...)", path.Join(outputPath, name))
 				return 0, nil
 			}
 			return 0, err
@@ -279,7 +280,7 @@ func extractDir(ls *ipld.LinkSystem, n ipld.Node, outputRoot, outputPath string,
 		count += ecount
 	}
 	if shardSkip > 0 {
-		fmt.Printf("data for entry not found for %d unknown sharded entries (skipped...)\n", shardSkip)
+		log.Printf("data for entry not found for %d unknown sharded entries (skipped...)", shardSkip)
 	}
 	return count, nil
 }
@@ -293,16 +294,16 @@ func extractFile(ls *ipld.LinkSystem, n ipld.Node, outputName string) error {
 	if err != nil {
 		return err
 	}
-	var f *os.File
+	// Stdout may carry the MCP protocol, so files are only ever written
+	// to the output directory
 	if outputName == "" {
-		f = os.Stdout
-	} else {
-		f, err = os.Create(outputName)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
+		return errors.New("no output directory to extract the file to")
+	}
+	f, err := os.Create(outputName)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 	_, err = io.Copy(f, nlr)
 	return err
 }
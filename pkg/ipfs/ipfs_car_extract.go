@@ -52,8 +52,9 @@ func ExtractCarFile(carfilePath string, outputDir string) (extractedFiles int, e
 	roots = store.(carstorage.ReadableCar).Roots()
 
 	// Initialize the link system with default settings and set the read storage to the Car file's storage.
+	// Storage is not trusted, so every block is rehashed against its CID as it is loaded.
 	ls := cidlink.DefaultLinkSystem()
-	ls.TrustedStorage = true
+	ls.TrustedStorage = false
 	ls.SetReadStorage(store)
 
 	// Iterate over the roots of the Car file.
@@ -2,21 +2,51 @@ package ipfs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"time"
+
+	gocid "github.com/ipfs/go-cid"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client represents a connection to an IPFS node with configurable network settings.
 type Client struct {
-	scheme   string // Protocol scheme (http/https)
-	host     string // Node hostname or IP
-	port     int    // Node port number
-	baseURL  string // Precomputed base URL for requests
-	timeout  time.Duration // HTTP request timeout
+	scheme   string           // Protocol scheme (http/https)
+	host     string           // Node hostname or IP
+	port     int              // Node port number
+	baseURL  string           // Precomputed base URL for requests
+	timeout  time.Duration    // HTTP request timeout
+	observe  RetrieveObserver // Optional callback for each retrieval
+	cache    *Cache           // Optional store of verified CARs
+	offline  bool             // Serve from the cache only
+	maxBytes int64            // Largest gateway response accepted
 }
 
+// ErrOffline is returned for content that is not cached while the client
+// is offline
+var ErrOffline = errors.New("not in the local cache and IPFS is offline")
+
+// ErrTooLarge is returned when a gateway response exceeds the client's
+// size limit
+var ErrTooLarge = errors.New("gateway response exceeds the size limit")
+
+// DefaultMaxResponseBytes bounds a gateway response unless
+// SetMaxResponseBytes says otherwise
+const DefaultMaxResponseBytes = 256 << 20
+
+// carContentType is the media type of CAR responses
+const carContentType = "application/vnd.ipld.car"
+
+// RetrieveObserver is called after every retrieval with the CID, the number
+// of bytes received, the elapsed time and the error, if any.
+type RetrieveObserver func(cid string, bytes int, elapsed time.Duration, err error)
+
 // NewClient creates a configured IPFS client instance.
 // scheme: Protocol (http/https)
 // host: Node hostname/IP
@@ -28,32 +58,126 @@ func NewClient(scheme, host string, port int, timeout time.Duration) *Client {
 	}
 
 	return &Client{
-		scheme:  scheme,
-		host:    host,
-		port:    port,
-		baseURL: fmt.Sprintf("%s://%s:%d/ipfs", scheme, host, port),
-		timeout: timeout,
+		scheme:   scheme,
+		host:     host,
+		port:     port,
+		baseURL:  fmt.Sprintf("%s://%s:%d/ipfs", scheme, host, port),
+		timeout:  timeout,
+		maxBytes: DefaultMaxResponseBytes,
 	}
 }
 
+// SetRetrieveObserver registers a callback invoked after each retrieval,
+// for example to export metrics. A nil observer disables it.
+func (c *Client) SetRetrieveObserver(observe RetrieveObserver) {
+	c.observe = observe
+}
+
+// SetCache makes retrievals read verified CARs from cache before going to
+// the gateway, and store what they fetch. A nil cache disables it.
+func (c *Client) SetCache(cache *Cache) {
+	c.cache = cache
+}
+
+// SetOffline makes retrievals fail with ErrOffline instead of contacting
+// the gateway when the content is not cached
+func (c *Client) SetOffline(offline bool) {
+	c.offline = offline
+}
+
+// SetMaxResponseBytes bounds the size of each gateway response; larger
+// responses fail with ErrTooLarge. Zero restores the default.
+func (c *Client) SetMaxResponseBytes(n int64) {
+	if n <= 0 {
+		n = DefaultMaxResponseBytes
+	}
+	c.maxBytes = n
+}
+
 // URLForCID constructs the full retrieval URL for a given CID.
 func (c *Client) URLForCID(cid string) string {
 	return fmt.Sprintf("%s/%s", c.baseURL, cid)
 }
 
 // Retrieve fetches content from IPFS by CID.
-// Returns the content bytes or an error if the request fails.
+// The gateway is not trusted: content is requested as CARs, every block is
+// checked against its CID and the result is a CAR of verified blocks only.
+// Returns the CAR bytes or an error if the request or verification fails.
 func (c *Client) Retrieve(cid string) ([]byte, error) {
-	return c.retrieveWithContext(context.Background(), cid)
+	return c.RetrieveContext(context.Background(), cid)
+}
+
+// RetrieveContext is Retrieve bounded by ctx, recording the retrieval as a
+// span of the trace in ctx.
+func (c *Client) RetrieveContext(ctx context.Context, cid string) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "ipfs.Retrieve", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("ipfs.cid", cid), attribute.String("ipfs.gateway", c.baseURL)))
+	if data, ok := c.cached(cid); ok {
+		span.SetAttributes(attribute.Bool("ipfs.cache_hit", true), attribute.Int("ipfs.bytes", len(data)))
+		endSpan(span, nil)
+		return data, nil
+	}
+	if c.offline {
+		err := fmt.Errorf("%w: %s", ErrOffline, cid)
+		endSpan(span, err)
+		return nil, err
+	}
+
+	start := time.Now()
+	data, err := retrieveModuleCAR(ctx, c, cid)
+	if c.observe != nil {
+		c.observe(cid, len(data), time.Since(start), err)
+	}
+	span.SetAttributes(attribute.Int("ipfs.bytes", len(data)))
+	endSpan(span, err)
+	if err == nil && c.cache != nil {
+		// The CAR was verified, so a failed write only costs a refetch
+		if parsed, parseErr := gocid.Decode(cid); parseErr == nil {
+			if cacheErr := c.cache.Put(parsed, data); cacheErr != nil {
+				log.Printf("Error caching CID %s: %v", cid, cacheErr)
+			}
+		}
+	}
+	return data, err
 }
 
-// retrieveWithContext handles the actual HTTP request with context support.
-func (c *Client) retrieveWithContext(ctx context.Context, cid string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.URLForCID(cid), nil)
+// cached returns the verified CAR of a CID from the cache, if any
+func (c *Client) cached(cid string) ([]byte, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+	parsed, err := gocid.Decode(cid)
+	if err != nil {
+		return nil, false
+	}
+	return c.cache.Get(parsed)
+}
+
+// Ping checks that the gateway accepts HTTP requests. Any response counts,
+// since gateways answer their root path with an error status.
+func (c *Client) Ping(ctx context.Context) error {
+	url := fmt.Sprintf("%s://%s:%d/", c.scheme, c.host, c.port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return fmt.Errorf("request creation failed: %w", err)
+	}
+	client := &http.Client{Timeout: c.timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gateway unreachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// fetchEntity requests one entity of a DAG as a CAR, following the
+// trustless gateway protocol, and verifies it while reading the response.
+func (c *Client) fetchEntity(ctx context.Context, root gocid.Cid) ([]carBlock, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URLForCID(root.String())+"?dag-scope=entity", nil)
 	if err != nil {
 		return nil, fmt.Errorf("request creation failed: %w", err)
 	}
-	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept", carContentType)
 
 	client := &http.Client{Timeout: c.timeout}
 	resp, err := client.Do(req)
@@ -65,11 +189,40 @@ func (c *Client) retrieveWithContext(ctx context.Context, cid string) ([]byte, e
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
+	if resp.ContentLength > c.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, resp.ContentLength, c.maxBytes)
+	}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read failed: %w", err)
+	body := &sizeLimitReader{r: resp.Body, remaining: c.maxBytes}
+	blocks, err := verifyCAR(root, body)
+	if body.exceeded() {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, c.maxBytes)
 	}
+	return blocks, err
+}
+
+// sizeLimitReader reads up to remaining bytes and fails once more arrive
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.exceeded() {
+		return 0, ErrTooLarge
+	}
+	// Read one byte past the limit to tell a full response from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.exceeded() {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
 
-	return data, nil
+func (l *sizeLimitReader) exceeded() bool {
+	return l.remaining < 0
 }
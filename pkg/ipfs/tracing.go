@@ -0,0 +1,20 @@
+package ipfs
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records retrievals and CAR extractions on the global tracer
+// provider; the spans are dropped unless the application installs one.
+var tracer = otel.Tracer("github.com/DANP-LABS/DANP-Engine/pkg/ipfs")
+
+// endSpan records err on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,152 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+)
+
+// ErrUnverified is wrapped by every retrieval error caused by content that
+// does not match the requested CID
+var ErrUnverified = errors.New("content does not match its CID")
+
+// carBlock is a block of a CAR whose data matched its CID
+type carBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// verifyCAR reads a CAR stream, checking every block hash against its CID
+// as it arrives and that the CAR is rooted at want. Any mismatch fails the
+// whole retrieval. It returns the blocks in stream order.
+func verifyCAR(want cid.Cid, r io.Reader) ([]carBlock, error) {
+	reader, err := carv2.NewBlockReader(r, carv2.WithTrustedCAR(false))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CAR response: %w", err)
+	}
+	if len(reader.Roots) != 1 || !sameContent(reader.Roots[0], want) {
+		return nil, fmt.Errorf("%w: CAR roots %v, expected %s", ErrUnverified, reader.Roots, want)
+	}
+
+	var blocks []carBlock
+	sawRoot := false
+	for {
+		block, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// The block reader rehashes each block, so tampered data ends here
+			return nil, fmt.Errorf("%w: %v", ErrUnverified, err)
+		}
+		if sameContent(block.Cid(), want) {
+			sawRoot = true
+		}
+		blocks = append(blocks, carBlock{cid: block.Cid(), data: block.RawData()})
+	}
+	if !sawRoot {
+		return nil, fmt.Errorf("%w: CAR does not contain the root block %s", ErrUnverified, want)
+	}
+	return blocks, nil
+}
+
+// sameContent reports whether two CIDs name the same data: CIDv0 and the
+// equivalent CIDv1 differ only in encoding
+func sameContent(a, b cid.Cid) bool {
+	return a.Type() == b.Type() && bytes.Equal(a.Hash(), b.Hash())
+}
+
+// retrieveModuleCAR retrieves a CID entity by entity and returns a CARv1
+// holding only verified blocks. An entity of a UnixFS directory is just its
+// listing, so each entry is then retrieved and verified by its own CID.
+func retrieveModuleCAR(ctx context.Context, client *Client, c string) ([]byte, error) {
+	root, err := cid.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID %q: %w", c, err)
+	}
+	blocks, err := client.fetchEntity(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &memstore.Store{}
+	for _, block := range blocks {
+		store.Put(ctx, string(block.cid.Bytes()), block.data)
+	}
+	entries, err := directoryEntries(store, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if has, _ := store.Has(ctx, string(entry.Bytes())); has {
+			continue
+		}
+		entryBlocks, err := client.fetchEntity(ctx, entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve directory entry %s: %w", entry, err)
+		}
+		blocks = append(blocks, entryBlocks...)
+	}
+
+	var buf bytes.Buffer
+	car, err := carstorage.NewWritable(&buf, []cid.Cid{root}, carv2.WriteAsCarV1(true))
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if err := car.Put(ctx, string(block.cid.Bytes()), block.data); err != nil {
+			return nil, fmt.Errorf("failed to assemble CAR: %w", err)
+		}
+	}
+	if err := car.Finalize(); err != nil {
+		return nil, fmt.Errorf("failed to assemble CAR: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// directoryEntries lists the CIDs a UnixFS directory root links to. Roots
+// that are not directories have no entries.
+func directoryEntries(store *memstore.Store, root cid.Cid) ([]cid.Cid, error) {
+	if root.Prefix().Codec != cid.DagProtobuf {
+		return nil, nil
+	}
+	ls := cidlink.DefaultLinkSystem()
+	ls.SetReadStorage(store)
+	pbn, err := ls.Load(ipld.LinkContext{}, cidlink.Link{Cid: root}, dagpb.Type.PBNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode root %s: %w", root, err)
+	}
+	node, err := unixfsnode.Reify(ipld.LinkContext{}, pbn, &ls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode root %s: %w", root, err)
+	}
+	if node.Kind() != ipld.Kind_Map {
+		return nil, nil
+	}
+
+	var entries []cid.Cid
+	it := node.MapIterator()
+	for !it.Done() {
+		_, value, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list directory %s: %w", root, err)
+		}
+		link, err := value.AsLink()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list directory %s: %w", root, err)
+		}
+		entries = append(entries, link.(cidlink.Link).Cid)
+	}
+	return entries, nil
+}
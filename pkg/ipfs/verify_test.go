@@ -0,0 +1,115 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+)
+
+// rawBlock returns data as a block under its raw-codec CIDv1
+func rawBlock(t *testing.T, data string) carBlock {
+	t.Helper()
+	prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: 0x12, MhLength: -1}
+	c, err := prefix.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return carBlock{cid: c, data: []byte(data)}
+}
+
+// buildCAR writes a CARv1 with the given roots and blocks. Blocks are
+// written as given, so their data need not match their CIDs.
+func buildCAR(t *testing.T, roots []cid.Cid, blocks ...carBlock) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	car, err := carstorage.NewWritable(&buf, roots, carv2.WriteAsCarV1(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if err := car.Put(context.Background(), string(block.cid.Bytes()), block.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := car.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestGateway serves cars by CID path and returns a client of it. The
+// responses are streamed without a Content-Length, as Lassie sends them.
+func newTestGateway(t *testing.T, cars map[string][]byte) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		car, ok := cars[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", carContentType)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		w.Write(car)
+	}))
+	t.Cleanup(srv.Close)
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return NewClient("http", host, port, 5*time.Second)
+}
+
+func TestFetchEntityVerifiesCAR(t *testing.T) {
+	module := rawBlock(t, "\x00asm module")
+	other := rawBlock(t, "something else")
+	valid := buildCAR(t, []cid.Cid{module.cid}, module)
+
+	tests := []struct {
+		name       string
+		car        []byte
+		maxBytes   int64
+		unverified bool
+		tooLarge   bool
+	}{
+		{name: "valid", car: valid},
+		{name: "wrong root", car: buildCAR(t, []cid.Cid{other.cid}, other), unverified: true},
+		{name: "mismatched block", car: buildCAR(t, []cid.Cid{module.cid}, carBlock{cid: module.cid, data: []byte("\x00asm tampered")}), unverified: true},
+		{name: "missing root block", car: buildCAR(t, []cid.Cid{module.cid}, other), unverified: true},
+		{name: "truncated", car: valid[:len(valid)-4], unverified: true},
+		{name: "too large", car: valid, maxBytes: int64(len(valid) - 1), tooLarge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestGateway(t, map[string][]byte{module.cid.String(): tt.car})
+			client.SetMaxResponseBytes(tt.maxBytes)
+			blocks, err := client.fetchEntity(context.Background(), module.cid)
+			switch {
+			case tt.unverified:
+				if !errors.Is(err, ErrUnverified) {
+					t.Fatalf("fetchEntity: error %v, want %v", err, ErrUnverified)
+				}
+			case tt.tooLarge:
+				if !errors.Is(err, ErrTooLarge) {
+					t.Fatalf("fetchEntity: error %v, want %v", err, ErrTooLarge)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("fetchEntity: %v", err)
+				}
+				if len(blocks) != 1 || !bytes.Equal(blocks[0].data, module.data) {
+					t.Errorf("fetchEntity returned %d blocks, want the module block", len(blocks))
+				}
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 
+	danp "github.com/DANP-LABS/DANP-Engine/core/mcp"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -16,7 +19,45 @@ type Client struct {
 	client *client.Client
 }
 
-func NewClient(ctx context.Context, stdioCmd, httpURL string) (*Client, error) {
+// HTTP transports a client can use to reach the server
+const (
+	TransportStreamableHTTP = "streamable_http"
+	TransportSSE            = "sse"
+	TransportWebSocket      = "websocket"
+)
+
+// ClientOption configures NewClient
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	transport string
+	headers   map[string]string
+	wallet    *danp.Wallet
+}
+
+// WithTransport selects the transport used for httpURL: streamable_http
+// (the default), sse or websocket. When the URL has no path, the server's
+// default endpoint for the transport is used (/, /sse or /ws).
+func WithTransport(name string) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = name
+	}
+}
+
+// WithBearerToken authenticates every request with an API key or a JWT
+// sent as an Authorization: Bearer header
+func WithBearerToken(token string) ClientOption {
+	return func(o *clientOptions) {
+		o.headers["Authorization"] = "Bearer " + token
+	}
+}
+
+func NewClient(ctx context.Context, stdioCmd, httpURL string, opts ...ClientOption) (*Client, error) {
+	options := clientOptions{transport: TransportStreamableHTTP, headers: map[string]string{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	var c *client.Client
 
 	if stdioCmd != "" {
@@ -53,12 +94,69 @@ func NewClient(ctx context.Context, stdioCmd, httpURL string) (*Client, error) {
 			}()
 		}
 	} else {
-		fmt.Println("Initializing HTTP client...")
-		httpTransport, err := transport.NewStreamableHTTP(httpURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create HTTP transport: %v", err)
+		// Wallet sign-in happens up front so that a rejected wallet fails
+		// here rather than on the first request
+		var session *walletSession
+		if options.wallet != nil {
+			var err error
+			if session, err = newWalletSession(options.wallet, httpURL); err != nil {
+				return nil, err
+			}
+			if err := session.signIn(ctx); err != nil {
+				return nil, err
+			}
+		}
+		headerFunc := func(ctx context.Context) map[string]string {
+			if session == nil {
+				return nil
+			}
+			return session.headers(ctx)
+		}
+
+		switch options.transport {
+		case TransportStreamableHTTP:
+			fmt.Println("Initializing HTTP client...")
+			httpTransport, err := transport.NewStreamableHTTP(httpURL,
+				transport.WithHTTPHeaders(options.headers), transport.WithHTTPHeaderFunc(headerFunc))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create HTTP transport: %v", err)
+			}
+			c = client.NewClient(httpTransport)
+		case TransportSSE:
+			fmt.Println("Initializing SSE client...")
+			endpoint, err := endpointURL(httpURL, "/sse", false)
+			if err != nil {
+				return nil, err
+			}
+			sseTransport, err := transport.NewSSE(endpoint,
+				transport.WithHeaders(options.headers), transport.WithHeaderFunc(headerFunc))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create SSE transport: %v", err)
+			}
+			c = client.NewClient(sseTransport)
+			if err := c.Start(ctx); err != nil {
+				return nil, fmt.Errorf("failed to start client: %v", err)
+			}
+		case TransportWebSocket:
+			fmt.Println("Initializing WebSocket client...")
+			endpoint, err := endpointURL(httpURL, "/ws", true)
+			if err != nil {
+				return nil, err
+			}
+			header := http.Header{}
+			for key, value := range options.headers {
+				header.Set(key, value)
+			}
+			for key, value := range headerFunc(ctx) {
+				header.Set(key, value)
+			}
+			c = client.NewClient(NewWebSocket(endpoint, header))
+			if err := c.Start(ctx); err != nil {
+				return nil, fmt.Errorf("failed to start client: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported transport %q", options.transport)
 		}
-		c = client.NewClient(httpTransport)
 	}
 
 	return &Client{client: c}, nil
@@ -88,6 +186,27 @@ func (c *Client) GetRawClient() *client.Client {
 	return c.client
 }
 
+// endpointURL fills in the default path of a transport and, for
+// WebSockets, switches http(s) to ws(s)
+func endpointURL(rawURL, defaultPath string, websocket bool) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %v", rawURL, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultPath
+	}
+	if websocket {
+		switch u.Scheme {
+		case "http":
+			u.Scheme = "ws"
+		case "https":
+			u.Scheme = "wss"
+		}
+	}
+	return u.String(), nil
+}
+
 func parseCommand(cmd string) []string {
 	var result []string
 	var current string
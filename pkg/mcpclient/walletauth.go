@@ -0,0 +1,141 @@
+package mcpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	danp "github.com/DANP-LABS/DANP-Engine/core/mcp"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// walletRenewBefore is how long before its expiry a wallet session is renewed
+const walletRenewBefore = time.Minute
+
+// WithWalletAuth signs in to the server with wallet using Sign-In with
+// Ethereum before connecting, and signs in again before the session token
+// expires. It applies to the HTTP transports.
+func WithWalletAuth(wallet *danp.Wallet) ClientOption {
+	return func(o *clientOptions) {
+		o.wallet = wallet
+	}
+}
+
+// walletSession holds the session token a wallet obtained from a server
+type walletSession struct {
+	wallet  *danp.Wallet
+	baseURL string
+	domain  string
+	client  *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newWalletSession(wallet *danp.Wallet, rawURL string) (*walletSession, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", rawURL)
+	}
+	scheme := u.Scheme
+	switch scheme {
+	case "ws":
+		scheme = "http"
+	case "wss":
+		scheme = "https"
+	}
+	return &walletSession{
+		wallet:  wallet,
+		baseURL: scheme + "://" + u.Host,
+		domain:  u.Host,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// signIn runs the challenge and token exchange. The message is built
+// locally, so the wallet only ever signs for the host it connects to.
+func (s *walletSession) signIn(ctx context.Context) error {
+	var challenge danp.SignInChallenge
+	if err := s.do(ctx, http.MethodGet, "/auth/challenge", nil, &challenge); err != nil {
+		return fmt.Errorf("wallet sign-in challenge failed: %w", err)
+	}
+
+	message := danp.SIWEMessage{
+		Domain:         s.domain,
+		Address:        s.wallet.Address,
+		Statement:      challenge.Statement,
+		URI:            s.baseURL,
+		Version:        "1",
+		ChainID:        challenge.ChainID,
+		Nonce:          challenge.Nonce,
+		IssuedAt:       time.Now().UTC().Truncate(time.Second),
+		ExpirationTime: challenge.ExpirationTime,
+	}.String()
+	signature, err := s.wallet.SignMessage([]byte(message))
+	if err != nil {
+		return err
+	}
+
+	var resp danp.SignInResponse
+	req := danp.SignInRequest{Message: message, Signature: hexutil.Encode(signature)}
+	if err := s.do(ctx, http.MethodPost, "/auth/token", req, &resp); err != nil {
+		return fmt.Errorf("wallet sign-in failed: %w", err)
+	}
+	s.token, s.expires = resp.Token, resp.ExpiresAt
+	log.Printf("Signed in as %s until %s", resp.Address, resp.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+func (s *walletSession) do(ctx context.Context, method, path string, body, out any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("%s: %s", resp.Status, failure.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// headers returns the Authorization header, renewing the session first
+// when it is about to expire. A failed renewal keeps the current token.
+func (s *walletSession) headers(ctx context.Context) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" || time.Until(s.expires) < walletRenewBefore {
+		if err := s.signIn(ctx); err != nil {
+			log.Printf("Error renewing wallet session: %v", err)
+		}
+	}
+	if s.token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + s.token}
+}
@@ -0,0 +1,193 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// WebSocket is an MCP client transport that carries one JSON-RPC message
+// per WebSocket text message, as served on the server's /ws endpoint
+type WebSocket struct {
+	url    string
+	header http.Header
+
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu                  sync.Mutex
+	pending             map[string]chan *transport.JSONRPCResponse
+	notificationHandler func(mcp.JSONRPCNotification)
+	closed              chan struct{}
+	closeOnce           sync.Once
+	err                 error
+}
+
+// NewWebSocket creates a WebSocket transport for a ws:// or wss:// URL
+func NewWebSocket(url string, header http.Header) *WebSocket {
+	return &WebSocket{
+		url:     url,
+		header:  header,
+		pending: make(map[string]chan *transport.JSONRPCResponse),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Start dials the server and starts reading messages
+func (t *WebSocket) Start(ctx context.Context) error {
+	dialer := websocket.Dialer{Subprotocols: []string{"mcp"}}
+	conn, _, err := dialer.DialContext(ctx, t.url, t.header)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", t.url, err)
+	}
+	t.conn = conn
+	go t.readLoop()
+	return nil
+}
+
+func (t *WebSocket) readLoop() {
+	for {
+		_, data, err := t.conn.ReadMessage()
+		if err != nil {
+			t.shutdown(err)
+			return
+		}
+
+		// Responses carry an id and a result or error; anything else with
+		// a method is a notification
+		var message struct {
+			ID     *mcp.RequestId  `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Printf("Ignoring malformed WebSocket message: %v", err)
+			continue
+		}
+
+		if message.ID != nil && message.Method == "" {
+			var response transport.JSONRPCResponse
+			if err := json.Unmarshal(data, &response); err != nil {
+				log.Printf("Ignoring malformed JSON-RPC response: %v", err)
+				continue
+			}
+			t.mu.Lock()
+			ch, ok := t.pending[response.ID.String()]
+			delete(t.pending, response.ID.String())
+			t.mu.Unlock()
+			if ok {
+				ch <- &response
+			}
+			continue
+		}
+
+		if message.ID == nil && message.Method != "" {
+			var notification mcp.JSONRPCNotification
+			if err := json.Unmarshal(data, &notification); err != nil {
+				log.Printf("Ignoring malformed JSON-RPC notification: %v", err)
+				continue
+			}
+			t.mu.Lock()
+			handler := t.notificationHandler
+			t.mu.Unlock()
+			if handler != nil {
+				handler(notification)
+			}
+		}
+	}
+}
+
+// SendRequest sends a request and waits for its response
+func (t *WebSocket) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	id := request.ID.String()
+	ch := make(chan *transport.JSONRPCResponse, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	if err := t.write(request); err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-t.closed:
+		return nil, t.err
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// SendNotification sends a notification to the server
+func (t *WebSocket) SendNotification(ctx context.Context, notification mcp.JSONRPCNotification) error {
+	return t.write(notification)
+}
+
+// SetNotificationHandler sets the handler for server notifications
+func (t *WebSocket) SetNotificationHandler(handler func(notification mcp.JSONRPCNotification)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notificationHandler = handler
+}
+
+// Close closes the connection
+func (t *WebSocket) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	t.writeMu.Lock()
+	t.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	t.writeMu.Unlock()
+	t.shutdown(errors.New("transport closed"))
+	return t.conn.Close()
+}
+
+// GetSessionId returns an empty string; the server identifies WebSocket
+// sessions by their connection
+func (t *WebSocket) GetSessionId() string {
+	return ""
+}
+
+func (t *WebSocket) write(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if err := t.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// shutdown fails pending requests once the connection is gone
+func (t *WebSocket) shutdown(err error) {
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		t.err = fmt.Errorf("websocket connection closed: %w", err)
+		t.mu.Unlock()
+		close(t.closed)
+	})
+}